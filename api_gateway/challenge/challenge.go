@@ -0,0 +1,214 @@
+package challenge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"seckill-mall/common/config"
+	"seckill-mall/common/utils"
+)
+
+// 内置的挑战类型
+const (
+	KindNone  = "none"  //不设挑战
+	KindMath  = "math"  //算术题(文本)
+	KindImage = "image" //算术题渲染成图片
+	KindPoW   = "pow"   //工作量证明：找到 x 使 SHA-256(prefix + x) 前 bits 位为 0
+)
+
+// DefaultKind 未配置挑战类型时使用工作量证明
+// math 的题目是纯文本，脚本用正则即可解出，只用于开发调试
+const DefaultKind = KindPoW
+
+// 挑战 Key：seckill:challenge:<挑战ID>，只能作答一次
+const (
+	challengePrefix = "seckill:challenge:"
+	DefaultTTL      = 2 * time.Minute
+)
+
+var (
+	ErrUnknownKind = errors.New("不支持的挑战类型")
+	ErrExpired     = errors.New("验证已过期，请重新获取")
+	ErrWrongAnswer = errors.New("验证未通过，请重新获取")
+)
+
+// Puzzle 返回给客户端的题目，答案只保存在 Redis
+type Puzzle struct {
+	Kind     string `json:"kind"`
+	Question string `json:"question,omitempty"`
+	Image    string `json:"image,omitempty"`  //data:image/png;base64,...
+	Prefix   string `json:"prefix,omitempty"` //工作量证明的前缀
+	Bits     int    `json:"bits,omitempty"`   //工作量证明要求的前导 0 位数
+}
+
+// Challenger 一种挑战的出题与判题，可通过 Register 扩展
+type Challenger interface {
+	// Generate 按难度出题，返回题目与服务端保存的判题依据
+	Generate(difficulty int) (Puzzle, string, error)
+	// Verify 用出题时保存的判题依据校验答案
+	Verify(secret string, difficulty int, answer string) bool
+}
+
+var challengers = map[string]Challenger{
+	KindMath:  mathChallenger{},
+	KindImage: imageChallenger{},
+	KindPoW:   powChallenger{},
+}
+
+// Register 注册自定义挑战类型
+func Register(kind string, c Challenger) {
+	challengers[kind] = c
+}
+
+// record 保存在 Redis 中的挑战，与用户、商品绑定
+type record struct {
+	UserID     int64  `json:"uid"`
+	ProductID  int64  `json:"pid"`
+	Kind       string `json:"kind"`
+	Difficulty int    `json:"difficulty"`
+	Secret     string `json:"secret"`
+}
+
+var (
+	rdb *redis.Client
+	ttl = DefaultTTL
+)
+
+// Init 设置挑战使用的 Redis 与有效期
+func Init(client *redis.Client, expire time.Duration) {
+	rdb = client
+	if expire > 0 {
+		ttl = expire
+	}
+}
+
+// difficultyRanges 内置挑战类型允许的难度范围，0 表示使用该类型的默认难度
+// pow 的难度是前导 0 位数，math/image 的难度是题目等级，两者不能混用
+var difficultyRanges = map[string][2]int{
+	KindMath:  {1, 3},
+	KindImage: {1, 3},
+	KindPoW:   {1, maxPoWBits},
+}
+
+// Requirement 商品需要的挑战类型与难度：活动配置优先，其次为网关全局配置
+// 活动改用了与全局不同的挑战类型时不继承全局难度(单位不同)，未单独配置难度则用该类型的默认难度
+func Requirement(productID int64) (kind string, difficulty int) {
+	kind, difficulty = normalizeKind(config.Conf.Seckill.Challenge), config.Conf.Seckill.ChallengeDifficulty
+	if a := config.GetActivity(productID); a != nil {
+		if k := normalizeKind(a.Challenge); a.Challenge != "" && k != kind {
+			kind, difficulty = k, 0
+		}
+		if a.ChallengeDifficulty > 0 {
+			difficulty = a.ChallengeDifficulty
+		}
+	}
+	return
+}
+
+func normalizeKind(kind string) string {
+	if kind == "" {
+		return DefaultKind
+	}
+	return kind
+}
+
+// Validate 启动时校验全局与各活动配置的挑战类型及难度，自定义类型需在此之前 Register
+// release 为 true 时不允许使用 math
+func Validate(release bool) error {
+	type setting struct {
+		where      string
+		kind       string
+		difficulty int
+	}
+	global := normalizeKind(config.Conf.Seckill.Challenge)
+	settings := []setting{{"gateway.yaml seckill", global, config.Conf.Seckill.ChallengeDifficulty}}
+	for _, a := range config.Activities {
+		kind := global
+		if a.Challenge != "" {
+			kind = a.Challenge
+		}
+		settings = append(settings, setting{fmt.Sprintf("activity.yaml 商品 %d", a.ProductID), kind, a.ChallengeDifficulty})
+	}
+
+	for _, s := range settings {
+		if s.kind == KindNone {
+			continue
+		}
+		if _, ok := challengers[s.kind]; !ok {
+			return fmt.Errorf("%s 的 challenge: %w %q", s.where, ErrUnknownKind, s.kind)
+		}
+		if r, ok := difficultyRanges[s.kind]; ok && s.difficulty != 0 && (s.difficulty < r[0] || s.difficulty > r[1]) {
+			return fmt.Errorf("%s 的 challenge_difficulty: %s 挑战的难度应在 %d~%d 之间，实际为 %d", s.where, s.kind, r[0], r[1], s.difficulty)
+		}
+		if s.kind == KindMath {
+			if release {
+				return fmt.Errorf("%s 的 challenge: math 挑战可被脚本直接解出，仅用于开发环境，请改用 image 或 pow", s.where)
+			}
+			log.Printf("⚠️ %s 使用 math 挑战，仅用于开发调试", s.where)
+		}
+	}
+	return nil
+}
+
+// Required 获取秒杀地址前是否需要先通过挑战
+func Required(productID int64) bool {
+	kind, _ := Requirement(productID)
+	return kind != KindNone
+}
+
+// Issue 为用户出一道题，返回挑战ID与题目
+func Issue(ctx context.Context, userID, productID int64) (string, Puzzle, error) {
+	kind, difficulty := Requirement(productID)
+	c, ok := challengers[kind]
+	if !ok {
+		return "", Puzzle{}, fmt.Errorf("%w: %s", ErrUnknownKind, kind)
+	}
+
+	puzzle, secret, err := c.Generate(difficulty)
+	if err != nil {
+		return "", Puzzle{}, err
+	}
+	data, _ := json.Marshal(record{
+		UserID:     userID,
+		ProductID:  productID,
+		Kind:       kind,
+		Difficulty: difficulty,
+		Secret:     secret,
+	})
+
+	id := utils.NewTokenID()
+	if err := rdb.Set(ctx, challengePrefix+id, data, ttl).Err(); err != nil {
+		return "", Puzzle{}, err
+	}
+	return id, puzzle, nil
+}
+
+// Check 校验答案，无论对错挑战都会被删除，防止对同一道题反复试答
+func Check(ctx context.Context, userID, productID int64, id, answer string) error {
+	data, err := rdb.GetDel(ctx, challengePrefix+id).Bytes()
+	if err == redis.Nil {
+		return ErrExpired
+	}
+	if err != nil {
+		return err
+	}
+
+	var rec record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return err
+	}
+	if rec.UserID != userID || rec.ProductID != productID {
+		return ErrWrongAnswer
+	}
+	c, ok := challengers[rec.Kind]
+	if !ok || !c.Verify(rec.Secret, rec.Difficulty, answer) {
+		return ErrWrongAnswer
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package challenge
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand/v2"
+	"strconv"
+)
+
+// imageChallenger 把算术题渲染成带干扰的图片，难度同时决定题目与干扰强度
+type imageChallenger struct{}
+
+func (imageChallenger) Generate(difficulty int) (Puzzle, string, error) {
+	question, answer := arithmetic(difficulty)
+	img, err := renderPNG(question, difficulty)
+	if err != nil {
+		return Puzzle{}, "", err
+	}
+	return Puzzle{Kind: KindImage, Image: "data:image/png;base64," + img}, strconv.Itoa(answer), nil
+}
+
+func (imageChallenger) Verify(secret string, difficulty int, answer string) bool {
+	return mathChallenger{}.Verify(secret, difficulty, answer)
+}
+
+// 5x7 点阵字形，只包含算术题用到的字符
+var glyphs = map[rune][7]string{
+	'0': {"01110", "10001", "10011", "10101", "11001", "10001", "01110"},
+	'1': {"00100", "01100", "00100", "00100", "00100", "00100", "01110"},
+	'2': {"01110", "10001", "00001", "00010", "00100", "01000", "11111"},
+	'3': {"11110", "00001", "00001", "01110", "00001", "00001", "11110"},
+	'4': {"00010", "00110", "01010", "10010", "11111", "00010", "00010"},
+	'5': {"11111", "10000", "11110", "00001", "00001", "10001", "01110"},
+	'6': {"00110", "01000", "10000", "11110", "10001", "10001", "01110"},
+	'7': {"11111", "00001", "00010", "00100", "01000", "01000", "01000"},
+	'8': {"01110", "10001", "10001", "01110", "10001", "10001", "01110"},
+	'9': {"01110", "10001", "10001", "01111", "00001", "00010", "01100"},
+	'+': {"00000", "00100", "00100", "11111", "00100", "00100", "00000"},
+	'-': {"00000", "00000", "00000", "11111", "00000", "00000", "00000"},
+	'x': {"00000", "10001", "01010", "00100", "01010", "10001", "00000"},
+	'=': {"00000", "00000", "11111", "00000", "11111", "00000", "00000"},
+	'?': {"01110", "10001", "00001", "00010", "00100", "00000", "00100"},
+}
+
+const (
+	glyphScale = 4
+	glyphWidth = 6 * glyphScale //字宽加 1 列间距
+	imgPadding = 8
+	imgHeight  = 7*glyphScale + 2*imgPadding
+)
+
+// renderPNG 逐字绘制并随机上下抖动，再叠加噪点与干扰线
+func renderPNG(text string, difficulty int) (string, error) {
+	width := len(text)*glyphWidth + 2*imgPadding
+	img := image.NewRGBA(image.Rect(0, 0, width, imgHeight))
+	bg := color.RGBA{uint8(220 + rand.IntN(36)), uint8(220 + rand.IntN(36)), uint8(220 + rand.IntN(36)), 255}
+	for y := 0; y < imgHeight; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, bg)
+		}
+	}
+
+	x := imgPadding
+	for _, r := range text {
+		glyph, ok := glyphs[r]
+		if ok {
+			fg := randomInk()
+			dy := rand.IntN(imgPadding) - imgPadding/2
+			for row, line := range glyph {
+				for col, bit := range line {
+					if bit != '1' {
+						continue
+					}
+					for i := 0; i < glyphScale; i++ {
+						for j := 0; j < glyphScale; j++ {
+							img.SetRGBA(x+col*glyphScale+i, imgPadding+dy+row*glyphScale+j, fg)
+						}
+					}
+				}
+			}
+		}
+		x += glyphWidth
+	}
+
+	noise := width * imgHeight / 20 * max(difficulty, 1)
+	for i := 0; i < noise; i++ {
+		img.SetRGBA(rand.IntN(width), rand.IntN(imgHeight), randomInk())
+	}
+	for i := 0; i < 2+difficulty; i++ {
+		drawLine(img, rand.IntN(width), rand.IntN(imgHeight), rand.IntN(width), rand.IntN(imgHeight), randomInk())
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func randomInk() color.RGBA {
+	return color.RGBA{uint8(rand.IntN(150)), uint8(rand.IntN(150)), uint8(rand.IntN(150)), 255}
+}
+
+// drawLine Bresenham 画线
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		img.SetRGBA(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
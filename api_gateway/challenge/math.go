@@ -0,0 +1,41 @@
+package challenge
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+// mathChallenger 算术题，难度 1: 一位数加法；2: 两位数加减；3 及以上: 乘加混合
+type mathChallenger struct{}
+
+func (mathChallenger) Generate(difficulty int) (Puzzle, string, error) {
+	question, answer := arithmetic(difficulty)
+	return Puzzle{Kind: KindMath, Question: question}, strconv.Itoa(answer), nil
+}
+
+func (mathChallenger) Verify(secret string, _ int, answer string) bool {
+	return strings.TrimSpace(answer) == secret
+}
+
+// arithmetic 按难度生成算术题，结果不为负数
+func arithmetic(difficulty int) (string, int) {
+	switch {
+	case difficulty >= 3:
+		a, b, c := rand.IntN(8)+2, rand.IntN(8)+2, rand.IntN(9)+1
+		return fmt.Sprintf("%d x %d + %d = ?", a, b, c), a*b + c
+	case difficulty == 2:
+		a, b := rand.IntN(90)+10, rand.IntN(90)+10
+		if rand.IntN(2) == 0 {
+			return fmt.Sprintf("%d + %d = ?", a, b), a + b
+		}
+		if a < b {
+			a, b = b, a
+		}
+		return fmt.Sprintf("%d - %d = ?", a, b), a - b
+	default:
+		a, b := rand.IntN(9)+1, rand.IntN(9)+1
+		return fmt.Sprintf("%d + %d = ?", a, b), a + b
+	}
+}
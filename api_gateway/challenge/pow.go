@@ -0,0 +1,53 @@
+package challenge
+
+import (
+	"crypto/sha256"
+	"math/bits"
+
+	"seckill-mall/common/utils"
+)
+
+const (
+	defaultPoWBits = 16 //约 6.5 万次哈希，浏览器中几十到几百毫秒
+	maxPoWBits     = 28
+)
+
+// powChallenger 工作量证明，难度为要求的前导 0 位数
+// 判题只需一次哈希，求解的耗时则随难度指数增长，把瞬时洪峰摊开到数秒内
+type powChallenger struct{}
+
+func (powChallenger) Generate(difficulty int) (Puzzle, string, error) {
+	n := powBits(difficulty)
+	prefix := utils.NewTokenID()
+	return Puzzle{Kind: KindPoW, Prefix: prefix, Bits: n}, prefix, nil
+}
+
+func (powChallenger) Verify(prefix string, difficulty int, answer string) bool {
+	if answer == "" || len(answer) > 64 {
+		return false
+	}
+	return LeadingZeroBits(sha256.Sum256([]byte(prefix+answer))) >= powBits(difficulty)
+}
+
+func powBits(difficulty int) int {
+	switch {
+	case difficulty <= 0:
+		return defaultPoWBits
+	case difficulty > maxPoWBits:
+		return maxPoWBits
+	default:
+		return difficulty
+	}
+}
+
+// LeadingZeroBits 哈希值的前导 0 位数
+func LeadingZeroBits(sum [sha256.Size]byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
@@ -2,9 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,19 +20,33 @@ import (
 	resolver "go.etcd.io/etcd/client/v3/naming/resolver"
 
 	"seckill-mall/common/config"
+	"seckill-mall/common/graceful"
 	"seckill-mall/common/pb"
 	"seckill-mall/common/tracer"
 
+	"seckill-mall/api_gateway/challenge"
 	"seckill-mall/api_gateway/middleware"
+	"seckill-mall/api_gateway/seckill"
+	"seckill-mall/api_gateway/session"
 
 	"seckill-mall/common/utils"
 
+	"github.com/redis/go-redis/v9"
+
 	sentinel "github.com/alibaba/sentinel-golang/api"
 	"github.com/alibaba/sentinel-golang/core/flow"
+	"github.com/alibaba/sentinel-golang/core/hotspot"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 )
 
+const mockLoginEnv = "SECKILL_MOCK_LOGIN"
+
+// 未配置 rate_limits 时沿用原先的下单整体限流
+var defaultRateLimits = []config.RateLimitConfig{
+	{Resource: "create_order", QPS: 1000},
+}
+
 func initSentinel() {
 	// 初始化 Sentinel
 	err := sentinel.InitDefault()
@@ -36,20 +54,79 @@ func initSentinel() {
 		log.Fatalf("初始化 Sentinel 失败: %v", err)
 	}
 
-	// 配置限流规则
-	_, err = flow.LoadRules([]*flow.Rule{
-		{
-			Resource:               "create_order", // 资源名称
-			TokenCalculateStrategy: flow.Direct,    //直接计数
-			ControlBehavior:        flow.Reject,    //直接拒绝
-			Threshold:              1000,           // 为了测试暂定每秒允许的最大请求数为1000
-			StatIntervalInMs:       1000,           // 统计周期1秒
-		},
-	})
-	if err != nil {
+	limits := config.Conf.RateLimits
+	if len(limits) == 0 {
+		limits = defaultRateLimits
+	}
+
+	// 按资源生成规则：整体 QPS 用流控规则，每用户/每IP 用热点参数规则
+	var flowRules []*flow.Rule
+	var hotRules []*hotspot.Rule
+	for _, l := range limits {
+		duration := l.DurationSec
+		if duration <= 0 {
+			duration = 1
+		}
+		if l.QPS > 0 {
+			flowRules = append(flowRules, &flow.Rule{
+				Resource:               l.Resource,  // 资源名称
+				TokenCalculateStrategy: flow.Direct, //直接计数
+				ControlBehavior:        flow.Reject, //直接拒绝
+				Threshold:              l.QPS,       // 每秒允许的最大请求数
+				StatIntervalInMs:       1000,        // 统计周期1秒
+			})
+		}
+		if l.PerUser > 0 {
+			hotRules = append(hotRules, hotParamRule(l.Resource, middleware.ParamUserID, l.PerUser, duration))
+		}
+		if l.PerIP > 0 {
+			hotRules = append(hotRules, hotParamRule(l.Resource, middleware.ParamIP, l.PerIP, duration))
+			middleware.ExemptIPs(l.Resource, l.ExemptIPs)
+		}
+		log.Printf("Sentinel限流规则: %s 整体 %.0f QPS，每用户 %d 次/%ds，每IP %d 次/%ds(0 表示不限)",
+			l.Resource, l.QPS, l.PerUser, duration, l.PerIP, duration)
+	}
+
+	if _, err = flow.LoadRules(flowRules); err != nil {
 		log.Fatalf("加载限流规则失败: %v", err)
 	}
-	log.Println("Sentinel限流规则已加载：create_order 每秒最大请求数 5")
+	if _, err = hotspot.LoadRules(hotRules); err != nil {
+		log.Fatalf("加载热点参数限流规则失败: %v", err)
+	}
+}
+
+// hotParamRule 按参数值分别计数的热点限流规则，超过阈值直接拒绝
+func hotParamRule(resource, paramKey string, threshold, duration int64) *hotspot.Rule {
+	return &hotspot.Rule{
+		Resource:          resource,
+		MetricType:        hotspot.QPS,
+		ControlBehavior:   hotspot.Reject,
+		ParamKey:          paramKey,
+		Threshold:         threshold,
+		DurationInSec:     duration,
+		ParamsMaxCapacity: 100000, //最多同时统计的参数值个数(LRU)
+	}
+}
+
+// parseExpire 解析有效期配置，未配置或格式错误时使用默认值
+func parseExpire(s string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
+
+// tokenResponse 登录与刷新的统一返回，token 保持与旧版登录接口兼容
+func tokenResponse(message string, pair *utils.TokenPair) gin.H {
+	return gin.H{
+		"code":           200,
+		"message":        message,
+		"token":          pair.AccessToken,
+		"refresh_token":  pair.RefreshToken,
+		"expire":         session.AccessExpire().String(),
+		"refresh_expire": session.RefreshExpire().String(),
+	}
 }
 
 func main() {
@@ -79,6 +156,33 @@ func main() {
 		log.Fatalf("创建解析器失败: %v", err)
 	}
 
+	// 加载 JWT 签名密钥
+	if err := utils.InitJWT(config.Conf.JWT); err != nil {
+		log.Fatalf("初始化 JWT 密钥失败: %v", err)
+	}
+
+	// 连接 Redis，存放令牌黑名单与刷新令牌家族
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     config.Conf.Redis.Addr,
+		Password: config.Conf.Redis.Password,
+		DB:       config.Conf.Redis.DB,
+	})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		log.Fatalf("连接 Redis 失败: %v", err)
+	}
+	session.Init(rdb, parseExpire(config.Conf.JWT.Expire, 15*time.Minute), parseExpire(config.Conf.JWT.RefreshExpire, 7*24*time.Hour))
+
+	// release 模式下禁用模拟登录与 math 挑战等仅供开发使用的功能
+	release := config.Conf.Server.Mode == gin.ReleaseMode || gin.Mode() == gin.ReleaseMode
+
+	config.InitActivities()
+	seckill.Init(rdb, config.Conf.Seckill.PathTTL)
+	challenge.Init(rdb, config.Conf.Seckill.ChallengeTTL)
+	// 挑战类型拼错会让所有 /seckill/path 请求在运行时失败，启动时提前校验
+	if err := challenge.Validate(release); err != nil {
+		log.Fatalf("人机挑战配置有误: %v", err)
+	}
+
 	// 连接【商品服务】
 	connProduct, err := grpc.Dial(
 		"etcd:///seckill/product",
@@ -105,51 +209,184 @@ func main() {
 	}
 	orderClient := pb.NewOrderServiceClient(connOrder)
 
+	// 连接【用户服务】
+	connUser, err := grpc.Dial(
+		"etcd:///seckill/user",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+		grpc.WithResolvers(etcdResolver),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy":"round_robin"}`),
+	)
+	if err != nil {
+		log.Fatalf("无法连接用户服务: %v", err)
+	}
+	userClient := pb.NewUserServiceClient(connUser)
+
 	// 启动 Gin
 	r := gin.Default()
 
+	// 只信任配置的反向代理转发的 X-Forwarded-For，未配置时 ClientIP 即连接对端地址，客户端无法伪造限流用的 IP
+	if err := r.SetTrustedProxies(config.Conf.Server.TrustedProxies); err != nil {
+		log.Fatalf("可信代理配置有误: %v", err)
+	}
+
 	p := ginprometheus.NewPrometheus("gin") //添加Prometheus监控中间件
 	p.Use(r)
 
 	//添加Gin中间件，自动记录http请求
 	r.Use(otelgin.Middleware("api-gateway"))
 
-	//模拟登录接口
-	r.POST("/login", func(c *gin.Context) {
+	// 模拟登录默认关闭，需在配置中开启或设置环境变量 SECKILL_MOCK_LOGIN=true 显式开启
+	mockLogin := config.Conf.Auth.MockLogin
+	if v, err := strconv.ParseBool(os.Getenv(mockLoginEnv)); err == nil {
+		mockLogin = v
+	}
+	if mockLogin && release {
+		log.Println("⚠️ release 模式下禁止模拟登录，已忽略 auth.mock_login")
+		mockLogin = false
+	}
+	if mockLogin {
+		log.Printf("⚠️ 模拟登录已开启：/login 可直接按 user_id 签发 Token(映射为 %d + user_id，不会与真实用户冲突)，仅用于开发与压测", utils.MockUserIDBase)
+	}
+
+	// 接口: 公钥集合(JWKS)，供其他服务用 RS256/EdDSA 公钥自行验签
+	r.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(200, gin.H{"keys": utils.JWKS()})
+	})
+
+	// 接口: 注册
+	r.POST("/register", middleware.SentinelLimit("register"), func(c *gin.Context) {
+		var req struct {
+			Username string `json:"username" binding:"required"`
+			Password string `json:"password" binding:"required"`
+			Nickname string `json:"nickname"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "参数错误"})
+			return
+		}
+
+		resp, err := userClient.Register(c.Request.Context(), &pb.RegisterRequest{
+			Username: req.Username,
+			Password: req.Password,
+			Nickname: req.Nickname,
+		})
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if !resp.Success {
+			c.JSON(400, gin.H{"code": 400, "message": resp.Message})
+			return
+		}
+		c.JSON(200, gin.H{"code": 200, "message": resp.Message, "user_id": resp.UserId})
+	})
+
+	// 接口: 登录，用户名密码校验通过后才签发 Token
+	r.POST("/login", middleware.SentinelLimit("login"), func(c *gin.Context) {
 		type LoginReq struct {
-			UserID int64 `json:"user_id"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+			UserID   int64  `json:"user_id"` //仅模拟登录模式使用
 		}
 		var req LoginReq
 		if err := c.ShouldBind(&req); err != nil {
 			c.JSON(400, gin.H{"error": "参数错误"})
 			return
 		}
-		expireStr := config.Conf.JWT.Expire
 
-		//解析时间字符串
-		expireDuration, err := time.ParseDuration(expireStr)
-		if err != nil {
-			expireDuration = 2 * time.Hour
+		var userID int64
+		switch {
+		case req.Username != "":
+			resp, err := userClient.Login(c.Request.Context(), &pb.LoginRequest{
+				Username: req.Username,
+				Password: req.Password,
+			})
+			if err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+			if !resp.Success {
+				c.JSON(401, gin.H{"code": 401, "message": resp.Message})
+				return
+			}
+			userID = resp.UserId
+		case mockLogin && req.UserID > 0 && req.UserID < utils.MockUserIDBase:
+			userID = utils.MockUserIDBase + req.UserID
+		default:
+			c.JSON(400, gin.H{"error": "请输入用户名和密码"})
+			return
 		}
 
-		// 生成Token
-		token, err := utils.GenerateToken(req.UserID, expireDuration)
-
+		pair, err := session.Issue(c.Request.Context(), userID)
 		if err != nil {
+			log.Printf("签发Token失败: %v", err)
 			c.JSON(500, gin.H{"error": "生成Token失败"})
 			return
 		}
+		c.JSON(200, tokenResponse("登录成功", pair))
+	})
 
-		c.JSON(200, gin.H{
-			"code":    200,
-			"message": "登录成功",
-			"token":   token,
-			"expire":  expireStr,
-		})
+	// 接口: 刷新Token，旧的刷新令牌随即失效；重复使用已轮换的刷新令牌会吊销整个登录会话
+	r.POST("/token/refresh", func(c *gin.Context) {
+		var req struct {
+			RefreshToken string `json:"refresh_token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "参数错误"})
+			return
+		}
+
+		pair, err := session.Refresh(c.Request.Context(), req.RefreshToken)
+		switch {
+		case errors.Is(err, session.ErrRefreshReused):
+			c.JSON(401, gin.H{"code": 401, "message": "刷新令牌已被使用，登录会话已失效，请重新登录"})
+			return
+		case errors.Is(err, session.ErrRefreshInvalid):
+			c.JSON(401, gin.H{"code": 401, "message": "刷新令牌无效或已过期，请重新登录"})
+			return
+		case err != nil:
+			log.Printf("刷新Token失败: %v", err)
+			c.JSON(500, gin.H{"error": "刷新Token失败"})
+			return
+		}
+		c.JSON(200, tokenResponse("刷新成功", pair))
+	})
+
+	// 接口: 登出，吊销当前访问令牌及同一会话的刷新令牌
+	r.POST("/logout", middleware.JWTAuth(), func(c *gin.Context) {
+		claims := c.MustGet("claims").(*utils.UserClaims)
+		if err := session.Revoke(c.Request.Context(), claims); err != nil {
+			log.Printf("吊销Token失败: %v", err)
+			c.JSON(500, gin.H{"error": "登出失败"})
+			return
+		}
+		c.JSON(200, gin.H{"code": 200, "message": "已登出"})
+	})
+
+	// 接口: 查询当前用户资料
+	r.GET("/user/profile", middleware.JWTAuth(), func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(401, gin.H{"error": "未鉴权用户"})
+			return
+		}
+
+		resp, err := userClient.GetProfile(c.Request.Context(), &pb.ProfileRequest{UserId: userID.(int64)})
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if !resp.Success {
+			c.JSON(404, gin.H{"code": 404, "message": resp.Message})
+			return
+		}
+		c.JSON(200, gin.H{"code": 200, "data": resp})
 	})
 
 	// 接口: 查询商品
-	r.GET("/product/:id", func(c *gin.Context) {
+	r.GET("/product/:id", middleware.SentinelLimit("get_product"), func(c *gin.Context) {
 		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
 		resp, err := productClient.GetProduct(c.Request.Context(), &pb.ProductRequest{ProductId: id})
 		if err != nil {
@@ -159,8 +396,90 @@ func main() {
 		c.JSON(200, gin.H{"data": resp})
 	})
 
-	// 接口: 下单
-	r.POST("/order", middleware.SentinelLimit("create_order"), middleware.JWTAuth(), func(c *gin.Context) {
+	// 接口: 获取人机挑战(验证码或工作量证明)，通过后才能获取秒杀地址
+	r.GET("/seckill/challenge/:productId", middleware.JWTAuth(), func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(401, gin.H{"error": "未鉴权用户"})
+			return
+		}
+		productID, err := strconv.ParseInt(c.Param("productId"), 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "参数错误"})
+			return
+		}
+
+		if err := seckill.CheckOpen(productID, time.Now()); err != nil {
+			c.JSON(403, gin.H{"code": 403, "message": err.Error()})
+			return
+		}
+		if !challenge.Required(productID) {
+			c.JSON(200, gin.H{"code": 200, "required": false})
+			return
+		}
+
+		id, puzzle, err := challenge.Issue(c.Request.Context(), userID.(int64), productID)
+		if err != nil {
+			log.Printf("生成挑战失败: %v", err)
+			c.JSON(500, gin.H{"error": "生成挑战失败"})
+			return
+		}
+		c.JSON(200, gin.H{
+			"code":         200,
+			"required":     true,
+			"challenge_id": id,
+			"challenge":    puzzle,
+		})
+	})
+
+	// 接口: 获取秒杀地址，活动开始后才发放，每个用户每个商品一次性有效
+	// 商品配置了人机挑战时需带上 challenge_id 与 answer
+	r.GET("/seckill/path/:productId", middleware.JWTAuth(), func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(401, gin.H{"error": "未鉴权用户"})
+			return
+		}
+		productID, err := strconv.ParseInt(c.Param("productId"), 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "参数错误"})
+			return
+		}
+
+		if err := seckill.CheckOpen(productID, time.Now()); err != nil {
+			c.JSON(403, gin.H{"code": 403, "message": err.Error()})
+			return
+		}
+
+		if challenge.Required(productID) {
+			err := challenge.Check(c.Request.Context(), userID.(int64), productID, c.Query("challenge_id"), c.Query("answer"))
+			switch {
+			case errors.Is(err, challenge.ErrExpired), errors.Is(err, challenge.ErrWrongAnswer):
+				c.JSON(403, gin.H{"code": 403, "message": err.Error()})
+				return
+			case err != nil:
+				log.Printf("校验挑战失败: %v", err)
+				c.JSON(500, gin.H{"error": "校验挑战失败"})
+				return
+			}
+		}
+
+		path, err := seckill.IssuePath(c.Request.Context(), userID.(int64), productID)
+		if err != nil {
+			log.Printf("生成秒杀地址失败: %v", err)
+			c.JSON(500, gin.H{"error": "获取秒杀地址失败"})
+			return
+		}
+		c.JSON(200, gin.H{
+			"code":   200,
+			"path":   path,
+			"url":    "/seckill/" + path + "/order",
+			"expire": seckill.PathTTL().String(),
+		})
+	})
+
+	// 接口: 下单，地址中的令牌在下单时原子消费
+	r.POST("/seckill/:path/order", middleware.JWTAuth(), middleware.SentinelLimit("create_order"), func(c *gin.Context) {
 
 		//从Context中获取UserID，需要将Context里的interface{}类型断言为int64
 		userID, exists := c.Get("userID")
@@ -178,6 +497,17 @@ func main() {
 			return
 		}
 
+		ok, err := seckill.ConsumePath(c.Request.Context(), userID.(int64), req.ProductID, c.Param("path"))
+		if err != nil {
+			log.Printf("校验秒杀地址失败: %v", err)
+			c.JSON(500, gin.H{"error": "校验秒杀地址失败"})
+			return
+		}
+		if !ok {
+			c.JSON(403, gin.H{"code": 403, "message": "秒杀地址无效或已使用，请重新获取"})
+			return
+		}
+
 		resp, err := orderClient.CreateOrder(c.Request.Context(), &pb.CreateOrderRequest{
 			UserId:    userID.(int64),
 			ProductId: req.ProductID,
@@ -196,6 +526,157 @@ func main() {
 		})
 	})
 
+	// 接口: 查询下单结果
+	r.GET("/order/:orderId", middleware.JWTAuth(), func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(401, gin.H{"error": "未鉴权用户"})
+			return
+		}
+
+		resp, err := orderClient.GetOrderStatus(c.Request.Context(), &pb.OrderStatusRequest{
+			OrderId: c.Param("orderId"),
+			UserId:  userID.(int64),
+		})
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, gin.H{"code": 200, "data": resp})
+	})
+
+	// 接口: 售罄后加入候补
+	r.POST("/waitlist", middleware.JWTAuth(), func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(401, gin.H{"error": "未鉴权用户"})
+			return
+		}
+
+		var req struct {
+			ProductID int64 `json:"product_id"`
+			Count     int32 `json:"count"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "参数错误"})
+			return
+		}
+
+		resp, err := productClient.JoinWaitlist(c.Request.Context(), &pb.WaitlistRequest{
+			ProductId: req.ProductID,
+			UserId:    userID.(int64),
+			Count:     req.Count,
+		})
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, gin.H{"code": 200, "data": resp})
+	})
+
+	// 接口: 查询我的通知(候补下单结果等)
+	r.GET("/notifications", middleware.JWTAuth(), func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(401, gin.H{"error": "未鉴权用户"})
+			return
+		}
+
+		resp, err := orderClient.GetNotifications(c.Request.Context(), &pb.NotificationRequest{UserId: userID.(int64)})
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, gin.H{"code": 200, "data": resp.Notifications})
+	})
+
+	// 接口: 抽签登记
+	r.POST("/raffle/:productId", middleware.JWTAuth(), func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(401, gin.H{"error": "未鉴权用户"})
+			return
+		}
+
+		productID, _ := strconv.ParseInt(c.Param("productId"), 10, 64)
+		resp, err := orderClient.RegisterRaffle(c.Request.Context(), &pb.RaffleRequest{
+			ProductId: productID,
+			UserId:    userID.(int64),
+		})
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, gin.H{"code": 200, "data": resp})
+	})
+
+	// 接口: 查询抽签状态与结果(开奖后公开种子，可用 raffle_verify 复现)
+	r.GET("/raffle/:productId", middleware.JWTAuth(), func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(401, gin.H{"error": "未鉴权用户"})
+			return
+		}
+
+		productID, _ := strconv.ParseInt(c.Param("productId"), 10, 64)
+		resp, err := orderClient.GetRaffle(c.Request.Context(), &pb.RaffleRequest{
+			ProductId: productID,
+			UserId:    userID.(int64),
+		})
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, gin.H{"code": 200, "data": resp})
+	})
+
+	// 接口: 开奖后公开参与名单(每行一个 UserID，与摘要一致)，无需登录，保存后即可作为 raffle_verify 的 -participants 输入
+	r.GET("/raffle/:productId/participants", middleware.SentinelLimit("raffle_participants"), func(c *gin.Context) {
+		productID, _ := strconv.ParseInt(c.Param("productId"), 10, 64)
+		resp, err := orderClient.GetRaffleParticipants(c.Request.Context(), &pb.RaffleRequest{ProductId: productID})
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if !resp.Success {
+			c.JSON(400, gin.H{"error": resp.Message})
+			return
+		}
+
+		var body strings.Builder
+		for _, uid := range resp.Participants {
+			body.WriteString(strconv.FormatInt(uid, 10))
+			body.WriteByte('\n')
+		}
+		c.Header("X-Participants-Digest", resp.ParticipantsDigest)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=raffle_%d_participants.txt", productID))
+		c.String(200, body.String())
+	})
+
+	srv := &http.Server{Addr: ":8080", Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("网关启动失败: %v", err)
+		}
+	}()
 	fmt.Println("=== API 网关已启动 (Port: 8080) ===")
-	r.Run(":8080")
+
+	// 优雅关闭：停止接收新连接并等进行中的请求处理完，再断开下游连接，最后刷新链路追踪(defer)
+	graceful.WaitSignal()
+	ctx, cancel := graceful.Context()
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("HTTP 请求在 %v 内未处理完，强制关闭: %v", graceful.Timeout, err)
+	}
+	connProduct.Close()
+	connOrder.Close()
+	connUser.Close()
+	rdb.Close()
+	cli.Close()
+	fmt.Println("API 网关已关闭")
 }
@@ -1,7 +1,9 @@
 package middleware
 
 import (
+	"log"
 	"net/http"
+	"seckill-mall/api_gateway/session"
 	"seckill-mall/common/utils"
 	"strings"
 
@@ -32,7 +34,7 @@ func JWTAuth() gin.HandlerFunc {
 		}
 
 		//验证Token
-		claims, err := utils.ParseToken(parts[1])
+		claims, err := utils.ParseTokenOf(parts[1], utils.TokenAccess)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"code":    401,
@@ -41,8 +43,27 @@ func JWTAuth() gin.HandlerFunc {
 			return
 		}
 
+		//检查是否已登出或所在令牌家族已被吊销
+		revoked, err := session.IsRevoked(c.Request.Context(), claims)
+		if err != nil {
+			log.Printf("查询Token吊销状态失败: %v", err)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"code":    503,
+				"message": "鉴权服务暂不可用，请稍后再试",
+			})
+			return
+		}
+		if revoked {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"code":    401,
+				"message": "Token已失效，请重新登录",
+			})
+			return
+		}
+
 		//将解析出来的UserID存入Context
 		c.Set("userID", claims.UserID)
+		c.Set("claims", claims)
 
 		c.Next()
 	}
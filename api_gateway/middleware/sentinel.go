@@ -2,23 +2,59 @@ package middleware
 
 import (
 	"net/http"
+	"strconv"
 
 	sentinel "github.com/alibaba/sentinel-golang/api"
 	"github.com/alibaba/sentinel-golang/core/base"
+	"github.com/alibaba/sentinel-golang/core/flow"
+	"github.com/alibaba/sentinel-golang/core/hotspot"
 	"github.com/gin-gonic/gin"
 )
 
+// 热点参数在 Sentinel Entry 附件中的 Key，对应热点规则的 ParamKey
+const (
+	ParamUserID = "userID"
+	ParamIP     = "ip"
+)
+
+// 按资源豁免IP限流的连接对端地址
+var exemptIPs = map[string]map[string]bool{}
+
+// ExemptIPs 设置资源豁免IP限流的地址，只与连接对端地址比较，不受 X-Forwarded-For 影响
+func ExemptIPs(resourceName string, ips []string) {
+	set := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		set[ip] = true
+	}
+	exemptIPs[resourceName] = set
+}
+
+// SentinelLimit 资源级限流，同时按用户ID(需放在 JWTAuth 之后)与客户端IP做热点参数限流
 func SentinelLimit(resourceName string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		opts := []sentinel.EntryOption{
+			sentinel.WithTrafficType(base.Inbound), //TrafficType表示入口流量
+		}
+		if !exemptIPs[resourceName][c.RemoteIP()] {
+			opts = append(opts, sentinel.WithAttachment(ParamIP, c.ClientIP()))
+		}
+		if userID, ok := c.Get("userID"); ok {
+			opts = append(opts, sentinel.WithAttachment(ParamUserID, userID))
+		}
+
 		//进入Sentinel的Entry
-		//TrafficType表示入口流量
-		e, b := sentinel.Entry(resourceName, sentinel.WithTrafficType(base.Inbound))
+		e, b := sentinel.Entry(resourceName, opts...)
 		if b != nil {
 			//被限流或降级处理
-			//直接拦截
+			//直接拦截，并告知客户端多久后重试
+			c.Header("Retry-After", strconv.FormatInt(retryAfter(b), 10))
+			message := "活动太火爆了，请稍后再试~"
+			if _, ok := b.TriggeredRule().(*hotspot.Rule); ok {
+				message = "请求过于频繁，请稍后再试"
+			}
 			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
 				"code":    429,
-				"message": "活动太火爆了，请稍后再试~",
+				"message": message,
 			})
 			return
 		}
@@ -28,3 +64,18 @@ func SentinelLimit(resourceName string) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// retryAfter 按触发规则的统计周期估算重试等待秒数
+func retryAfter(b *base.BlockError) int64 {
+	switch rule := b.TriggeredRule().(type) {
+	case *hotspot.Rule:
+		if rule.DurationInSec > 0 {
+			return rule.DurationInSec
+		}
+	case *flow.Rule:
+		if rule.StatIntervalInMs > 0 {
+			return (int64(rule.StatIntervalInMs) + 999) / 1000
+		}
+	}
+	return 1
+}
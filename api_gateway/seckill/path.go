@@ -0,0 +1,97 @@
+package seckill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"seckill-mall/common/config"
+	"seckill-mall/common/utils"
+)
+
+// 秒杀地址 Key：seckill:path:<userID>:<productID>，值为一次性令牌
+const pathPrefix = "seckill:path:"
+
+const DefaultPathTTL = 30 * time.Second
+
+var (
+	ErrNotStarted = errors.New("活动尚未开始")
+	ErrEnded      = errors.New("活动已结束")
+	ErrRaffle     = errors.New("抽签活动请通过登记参与")
+)
+
+// 令牌一致才删除，避免猜错的请求把用户真正拿到的地址消耗掉
+// KEYS[1]: 秒杀地址 Key  ARGV[1]: 请求中的令牌
+// 返回 1 消费成功，0 不存在或不匹配
+const CONSUME_PATH_LUA = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+    redis.call('DEL', KEYS[1])
+    return 1
+end
+return 0
+`
+
+var consumeScript = redis.NewScript(CONSUME_PATH_LUA)
+
+var (
+	rdb     *redis.Client
+	pathTTL = DefaultPathTTL
+)
+
+// Init 设置秒杀地址使用的 Redis 与有效期
+func Init(client *redis.Client, ttl time.Duration) {
+	rdb = client
+	if ttl > 0 {
+		pathTTL = ttl
+	}
+}
+
+func pathKey(userID, productID int64) string {
+	return fmt.Sprintf("%s%d:%d", pathPrefix, userID, productID)
+}
+
+// CheckOpen 活动开始后才发放秒杀地址；未配置活动的商品不限时间
+func CheckOpen(productID int64, now time.Time) error {
+	activity := config.GetActivity(productID)
+	if activity == nil {
+		return nil
+	}
+	if activity.IsRaffle() {
+		return ErrRaffle
+	}
+	start, end, err := activity.Window()
+	if err != nil {
+		return err
+	}
+	if !start.IsZero() && now.Before(start) {
+		return ErrNotStarted
+	}
+	if !end.IsZero() && !now.Before(end) {
+		return ErrEnded
+	}
+	return nil
+}
+
+// IssuePath 为用户生成该商品的一次性秒杀地址，重复获取会使之前的地址失效
+func IssuePath(ctx context.Context, userID, productID int64) (string, error) {
+	path := utils.NewTokenID()
+	if err := rdb.Set(ctx, pathKey(userID, productID), path, pathTTL).Err(); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// ConsumePath 校验并原子地消费秒杀地址，每个地址只能下单一次
+func ConsumePath(ctx context.Context, userID, productID int64, path string) (bool, error) {
+	n, err := consumeScript.Run(ctx, rdb, []string{pathKey(userID, productID)}, path).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// PathTTL 秒杀地址有效期
+func PathTTL() time.Duration { return pathTTL }
@@ -0,0 +1,137 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"seckill-mall/common/utils"
+)
+
+// Redis Key 约定：
+//
+//	auth:denylist:<jti>        已吊销的访问令牌，过期时间与令牌剩余有效期一致
+//	auth:family:<fid>          家族当前唯一有效的刷新令牌 jti，随轮换续期
+//	auth:family:revoked:<fid>  家族已整体吊销，保留一个访问令牌有效期，期间该家族的访问令牌全部失效
+const (
+	denylistPrefix = "auth:denylist:"
+	familyPrefix   = "auth:family:"
+	revokedPrefix  = "auth:family:revoked:"
+)
+
+var (
+	ErrRefreshInvalid = errors.New("refresh token invalid or expired")
+	ErrRefreshReused  = errors.New("refresh token reused")
+)
+
+var (
+	rdb           *redis.Client
+	accessExpire  time.Duration
+	refreshExpire time.Duration
+)
+
+// 轮换刷新令牌：提交的 jti 必须是家族当前的 jti，否则视为重放，吊销整个家族
+// KEYS[1]: 家族 Key  KEYS[2]: 家族吊销标记
+// ARGV[1]: 提交的 jti  ARGV[2]: 新 jti  ARGV[3]: 刷新令牌有效期(ms)  ARGV[4]: 访问令牌有效期(ms)
+// 返回 1 轮换成功，0 家族不存在(已过期或已登出)，-1 检测到重放
+const ROTATE_LUA = `
+local cur = redis.call('GET', KEYS[1])
+if not cur then
+    return 0
+end
+if cur ~= ARGV[1] then
+    redis.call('DEL', KEYS[1])
+    redis.call('SET', KEYS[2], '1', 'PX', ARGV[4])
+    return -1
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+return 1
+`
+
+var rotateScript = redis.NewScript(ROTATE_LUA)
+
+// Init 设置令牌存储使用的 Redis 与令牌有效期
+func Init(client *redis.Client, access, refresh time.Duration) {
+	rdb = client
+	accessExpire = access
+	refreshExpire = refresh
+}
+
+// AccessExpire 访问令牌有效期
+func AccessExpire() time.Duration { return accessExpire }
+
+// RefreshExpire 刷新令牌有效期
+func RefreshExpire() time.Duration { return refreshExpire }
+
+// Issue 登录成功后开启新的令牌家族并签发令牌对
+func Issue(ctx context.Context, userID int64) (*utils.TokenPair, error) {
+	family := utils.NewTokenID()
+	pair, err := utils.GenerateTokenPair(userID, family, accessExpire, refreshExpire)
+	if err != nil {
+		return nil, err
+	}
+	if err := rdb.Set(ctx, familyPrefix+family, pair.RefreshClaims.ID, refreshExpire).Err(); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// Refresh 用刷新令牌换取新的令牌对，旧刷新令牌随即失效
+func Refresh(ctx context.Context, refreshToken string) (*utils.TokenPair, error) {
+	claims, err := utils.ParseTokenOf(refreshToken, utils.TokenRefresh)
+	if err != nil || claims.Family == "" {
+		return nil, ErrRefreshInvalid
+	}
+
+	pair, err := utils.GenerateTokenPair(claims.UserID, claims.Family, accessExpire, refreshExpire)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := rotateScript.Run(ctx, rdb,
+		[]string{familyPrefix + claims.Family, revokedPrefix + claims.Family},
+		claims.ID, pair.RefreshClaims.ID, refreshExpire.Milliseconds(), accessExpire.Milliseconds(),
+	).Int()
+	if err != nil {
+		return nil, err
+	}
+	switch res {
+	case 1:
+		return pair, nil
+	case -1:
+		log.Printf("🚨 [ALERT] 刷新令牌被重复使用，已吊销令牌家族: user=%d family=%s jti=%s", claims.UserID, claims.Family, claims.ID)
+		return nil, ErrRefreshReused
+	default:
+		return nil, ErrRefreshInvalid
+	}
+}
+
+// Revoke 登出：把访问令牌加入黑名单，并吊销其所在家族(刷新令牌随之失效)
+func Revoke(ctx context.Context, claims *utils.UserClaims) error {
+	pipe := rdb.TxPipeline()
+	if ttl := time.Until(claims.ExpiresAt.Time); ttl > 0 {
+		pipe.Set(ctx, denylistPrefix+claims.ID, 1, ttl)
+	}
+	if claims.Family != "" {
+		pipe.Del(ctx, familyPrefix+claims.Family)
+		pipe.Set(ctx, revokedPrefix+claims.Family, 1, accessExpire)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// IsRevoked 访问令牌是否已吊销，一次 EXISTS 同时检查 jti 黑名单与家族吊销标记
+func IsRevoked(ctx context.Context, claims *utils.UserClaims) (bool, error) {
+	keys := []string{denylistPrefix + claims.ID}
+	if claims.Family != "" {
+		keys = append(keys, revokedPrefix+claims.Family)
+	}
+	n, err := rdb.Exists(ctx, keys...).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
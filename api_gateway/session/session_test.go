@@ -0,0 +1,186 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+
+	"seckill-mall/common/config"
+	"seckill-mall/common/utils"
+)
+
+const (
+	testAccessExpire  = 15 * time.Minute
+	testRefreshExpire = 7 * 24 * time.Hour
+	testUserID        = 7
+)
+
+// setupSession 用 miniredis 代替 Redis，HS256 测试密钥签发令牌
+func setupSession(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	if err := utils.InitJWT(config.JWTConfig{Secret: "session-test-secret-0123456789abcdef"}); err != nil {
+		t.Fatalf("加载测试密钥失败: %v", err)
+	}
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	Init(client, testAccessExpire, testRefreshExpire)
+	return mr
+}
+
+// issue 登录签发一对令牌
+func issue(t *testing.T) *utils.TokenPair {
+	t.Helper()
+	pair, err := Issue(context.Background(), testUserID)
+	if err != nil {
+		t.Fatalf("签发令牌失败: %v", err)
+	}
+	return pair
+}
+
+// assertRevoked 访问令牌的吊销状态
+func assertRevoked(t *testing.T, claims *utils.UserClaims, want bool) {
+	t.Helper()
+	revoked, err := IsRevoked(context.Background(), claims)
+	if err != nil {
+		t.Fatalf("查询吊销状态失败: %v", err)
+	}
+	if revoked != want {
+		t.Fatalf("访问令牌 %s 吊销状态应为 %v，实际 %v", claims.ID, want, revoked)
+	}
+}
+
+func TestRefreshRotation(t *testing.T) {
+	mr := setupSession(t)
+	ctx := context.Background()
+	first := issue(t)
+
+	second, err := Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+	if second.RefreshClaims.Family != first.RefreshClaims.Family {
+		t.Fatal("轮换出的令牌应属于同一家族")
+	}
+	if second.RefreshClaims.ID == first.RefreshClaims.ID {
+		t.Fatal("轮换后应签发新的刷新令牌")
+	}
+	// 家族只记录最新的刷新令牌，有效期随轮换重新计时
+	familyKey := familyPrefix + first.RefreshClaims.Family
+	if cur, _ := mr.Get(familyKey); cur != second.RefreshClaims.ID {
+		t.Fatalf("家族当前 jti 应为 %s，实际 %s", second.RefreshClaims.ID, cur)
+	}
+	if ttl := mr.TTL(familyKey); ttl != testRefreshExpire {
+		t.Fatalf("家族有效期应为 %v，实际 %v", testRefreshExpire, ttl)
+	}
+
+	// 新的刷新令牌可以继续轮换，访问令牌都未被吊销
+	if _, err := Refresh(ctx, second.RefreshToken); err != nil {
+		t.Fatalf("再次刷新失败: %v", err)
+	}
+	assertRevoked(t, first.AccessClaims, false)
+	assertRevoked(t, second.AccessClaims, false)
+
+	// 访问令牌不能当作刷新令牌使用
+	if _, err := Refresh(ctx, second.AccessToken); !errors.Is(err, ErrRefreshInvalid) {
+		t.Fatalf("用访问令牌刷新应返回 ErrRefreshInvalid，得到 %v", err)
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	mr := setupSession(t)
+	ctx := context.Background()
+	first := issue(t)
+	other := issue(t) // 同一用户的另一次登录
+
+	second, err := Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+
+	// 已轮换掉的刷新令牌再次出现，说明令牌泄露，吊销整个家族
+	if _, err := Refresh(ctx, first.RefreshToken); !errors.Is(err, ErrRefreshReused) {
+		t.Fatalf("重放旧刷新令牌应返回 ErrRefreshReused，得到 %v", err)
+	}
+	if _, err := Refresh(ctx, second.RefreshToken); !errors.Is(err, ErrRefreshInvalid) {
+		t.Fatalf("家族吊销后最新的刷新令牌也应失效，得到 %v", err)
+	}
+	assertRevoked(t, first.AccessClaims, true)
+	assertRevoked(t, second.AccessClaims, true)
+
+	// 吊销标记保留一个访问令牌有效期，足以覆盖该家族签出的所有访问令牌
+	if ttl := mr.TTL(revokedPrefix + first.RefreshClaims.Family); ttl != testAccessExpire {
+		t.Fatalf("家族吊销标记有效期应为 %v，实际 %v", testAccessExpire, ttl)
+	}
+
+	// 其他家族不受影响
+	assertRevoked(t, other.AccessClaims, false)
+	if _, err := Refresh(ctx, other.RefreshToken); err != nil {
+		t.Fatalf("其他家族刷新失败: %v", err)
+	}
+}
+
+func TestLogoutDenylistsAccessToken(t *testing.T) {
+	setupSession(t)
+	ctx := context.Background()
+	pair := issue(t)
+	other := issue(t)
+
+	if err := Revoke(ctx, pair.AccessClaims); err != nil {
+		t.Fatalf("登出失败: %v", err)
+	}
+	assertRevoked(t, pair.AccessClaims, true)
+	if _, err := Refresh(ctx, pair.RefreshToken); !errors.Is(err, ErrRefreshInvalid) {
+		t.Fatalf("登出后刷新令牌应失效，得到 %v", err)
+	}
+
+	// 没有家族的访问令牌(如旧版本签发的)只按 jti 吊销
+	legacy := *other.AccessClaims
+	legacy.Family = ""
+	if err := Revoke(ctx, &legacy); err != nil {
+		t.Fatalf("登出失败: %v", err)
+	}
+	assertRevoked(t, &legacy, true)
+	assertRevoked(t, other.AccessClaims, true)
+	if _, err := Refresh(ctx, other.RefreshToken); err != nil {
+		t.Fatalf("只吊销访问令牌时刷新令牌仍可使用，得到 %v", err)
+	}
+}
+
+func TestDenylistTTL(t *testing.T) {
+	mr := setupSession(t)
+	ctx := context.Background()
+	pair := issue(t)
+
+	if err := Revoke(ctx, pair.AccessClaims); err != nil {
+		t.Fatalf("登出失败: %v", err)
+	}
+	// 黑名单只需保留到访问令牌过期
+	denyKey := denylistPrefix + pair.AccessClaims.ID
+	remaining := time.Until(pair.AccessClaims.ExpiresAt.Time)
+	if ttl := mr.TTL(denyKey); ttl <= 0 || ttl > testAccessExpire || remaining-ttl > time.Second {
+		t.Fatalf("黑名单有效期应接近令牌剩余有效期 %v，实际 %v", remaining, ttl)
+	}
+
+	mr.FastForward(testAccessExpire)
+	if mr.Exists(denyKey) || mr.Exists(revokedPrefix+pair.AccessClaims.Family) {
+		t.Fatal("访问令牌过期后黑名单与家族吊销标记应自动删除")
+	}
+
+	// 已过期的访问令牌登出不写黑名单
+	expired := *pair.AccessClaims
+	expired.ID = utils.NewTokenID()
+	expired.Family = ""
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Second))
+	if err := Revoke(ctx, &expired); err != nil {
+		t.Fatalf("登出失败: %v", err)
+	}
+	if mr.Exists(denylistPrefix + expired.ID) {
+		t.Fatal("已过期的访问令牌不应写入黑名单")
+	}
+}
@@ -0,0 +1,294 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Memory 进程内实现，语义与 RabbitMQ 实现一致：
+// 确认前消息算作未确认并占用 prefetch，Nack 放回队首或转投死信队列，延迟消息到期后回到目标队列，
+// 发布到不存在的队列返回 ErrUnroutable，订阅不存在的队列收不到消息；
+// 停止订阅时尚未交给订阅者的消息放回队列，已交出未确认的消息在 Close 时放回(对应 RabbitMQ 关闭通道)
+type Memory struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	queues    map[string]*memQueue
+	consumers []*memConsumer
+	closed    bool
+}
+
+type memQueue struct {
+	name       string
+	deadLetter []string
+	ready      []memEntry
+}
+
+type memEntry struct {
+	msg         Message
+	redelivered bool
+}
+
+// memConsumer 一个订阅，同时充当该订阅上消息的 Acker
+type memConsumer struct {
+	b        *Memory
+	q        *memQueue
+	prefetch int
+	out      chan Delivery
+	nextTag  uint64
+	unacked  map[uint64]memEntry
+	stopped  bool
+	done     chan struct{} // stop 时关闭，打断正在进行的投递
+	finished chan struct{} // dispatch 退出、通道关闭后关闭
+	stopOnce sync.Once
+}
+
+func NewMemory(queues ...Queue) *Memory {
+	b := &Memory{queues: map[string]*memQueue{}}
+	b.cond = sync.NewCond(&b.mu)
+	for _, q := range queues {
+		b.queues[q.Name] = &memQueue{name: q.Name, deadLetter: q.DeadLetter}
+	}
+	return b
+}
+
+func (b *Memory) Publish(ctx context.Context, queue string, msg Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.push(queue, memEntry{msg: copyMessage(msg)})
+}
+
+func (b *Memory) PublishDelayed(ctx context.Context, queue string, msg Message, delay time.Duration) error {
+	if delay <= 0 {
+		return b.Publish(ctx, queue, msg)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrClosed
+	}
+	if _, ok := b.queues[queue]; !ok {
+		return ErrUnroutable
+	}
+
+	msg = copyMessage(msg)
+	time.AfterFunc(delay, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.push(queue, memEntry{msg: msg})
+	})
+	return nil
+}
+
+// push 入队并唤醒消费者，调用方持有锁
+func (b *Memory) push(queue string, e memEntry) error {
+	if b.closed {
+		return ErrClosed
+	}
+	q, ok := b.queues[queue]
+	if !ok {
+		return ErrUnroutable
+	}
+	q.ready = append(q.ready, e)
+	b.cond.Broadcast()
+	return nil
+}
+
+func (b *Memory) Consume(queue string, prefetch int) (<-chan Delivery, func()) {
+	b.mu.Lock()
+	q, ok := b.queues[queue]
+	if !ok || b.closed {
+		b.mu.Unlock()
+		// 与 RabbitMQ 一致：订阅不存在的队列收不到任何消息，也不会因此建出队列
+		log.Printf("X! 内存队列 %s 不存在或 Broker 已关闭，订阅不会收到消息", queue)
+		out := make(chan Delivery)
+		close(out)
+		return out, func() {}
+	}
+	c := &memConsumer{
+		b:        b,
+		q:        q,
+		prefetch: prefetch,
+		out:      make(chan Delivery),
+		unacked:  map[uint64]memEntry{},
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	b.consumers = append(b.consumers, c)
+	b.mu.Unlock()
+
+	go c.dispatch()
+	return c.out, c.stop
+}
+
+// Close 关闭 Broker：订阅全部停止，未确认的消息放回各自队列
+func (b *Memory) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	consumers := b.consumers
+	b.consumers = nil
+	b.cond.Broadcast()
+	b.mu.Unlock()
+
+	for _, c := range consumers {
+		c.stop()
+		c.requeueUnacked()
+	}
+	return nil
+}
+
+// dispatch 按 prefetch 限制把队首消息推给订阅者
+func (c *memConsumer) dispatch() {
+	defer close(c.finished)
+	defer close(c.out)
+	b := c.b
+	for {
+		b.mu.Lock()
+		for !c.stopped && !b.closed && (len(c.q.ready) == 0 || (c.prefetch > 0 && len(c.unacked) >= c.prefetch)) {
+			b.cond.Wait()
+		}
+		if c.stopped || b.closed {
+			b.mu.Unlock()
+			return
+		}
+
+		e := c.q.ready[0]
+		c.q.ready = c.q.ready[1:]
+		c.nextTag++
+		tag := c.nextTag
+		c.unacked[tag] = e
+		b.mu.Unlock()
+
+		select {
+		case c.out <- Delivery{Message: e.msg, Tag: tag, Acker: c, Redelivered: e.redelivered}:
+		case <-c.done:
+			// 停止时还没交给订阅者，原样放回队首
+			b.mu.Lock()
+			delete(c.unacked, tag)
+			c.q.ready = append([]memEntry{e}, c.q.ready...)
+			b.cond.Broadcast()
+			b.mu.Unlock()
+			return
+		}
+	}
+}
+
+// stop 停止订阅：不再投递新消息，等通道关闭后返回；已收到的消息仍可确认
+func (c *memConsumer) stop() {
+	c.stopOnce.Do(func() {
+		c.b.mu.Lock()
+		c.stopped = true
+		close(c.done)
+		c.b.cond.Broadcast()
+		c.b.mu.Unlock()
+	})
+	<-c.finished
+}
+
+// requeueUnacked 把仍未确认的消息按投递顺序放回队首并标记为重新投递
+func (c *memConsumer) requeueUnacked() {
+	b := c.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tags := make([]uint64, 0, len(c.unacked))
+	for t := range c.unacked {
+		tags = append(tags, t)
+	}
+	slices.Sort(tags)
+
+	requeued := make([]memEntry, 0, len(tags))
+	for _, t := range tags {
+		e := c.unacked[t]
+		e.redelivered = true
+		e.msg = addDeliveries(e.msg, 1)
+		requeued = append(requeued, e)
+		delete(c.unacked, t)
+	}
+	c.q.ready = append(requeued, c.q.ready...)
+	b.cond.Broadcast()
+}
+
+func (c *memConsumer) Ack(tag uint64, multiple bool) error {
+	return c.settle(tag, multiple, func(memEntry) {})
+}
+
+func (c *memConsumer) Nack(tag uint64, multiple, requeue bool) error {
+	var requeued []memEntry
+	err := c.settle(tag, multiple, func(e memEntry) {
+		if requeue {
+			e.redelivered = true
+			e.msg = addDeliveries(e.msg, 1)
+			requeued = append(requeued, e)
+			return
+		}
+		c.deadLetter(e.msg, "rejected")
+	})
+	if len(requeued) > 0 {
+		c.b.mu.Lock()
+		c.q.ready = append(requeued, c.q.ready...)
+		c.b.cond.Broadcast()
+		c.b.mu.Unlock()
+	}
+	return err
+}
+
+// settle 按标签取出未确认的消息；与 RabbitMQ 一样，未知标签返回错误
+func (c *memConsumer) settle(tag uint64, multiple bool, fn func(memEntry)) error {
+	c.b.mu.Lock()
+	if _, ok := c.unacked[tag]; !ok {
+		c.b.mu.Unlock()
+		return fmt.Errorf("未知的投递标签 %d", tag)
+	}
+
+	var tags []uint64
+	if multiple {
+		for t := range c.unacked {
+			if t <= tag {
+				tags = append(tags, t)
+			}
+		}
+		slices.Sort(tags)
+	} else {
+		tags = []uint64{tag}
+	}
+
+	entries := make([]memEntry, 0, len(tags))
+	for _, t := range tags {
+		entries = append(entries, c.unacked[t])
+		delete(c.unacked, t)
+	}
+	c.b.cond.Broadcast() // 腾出了 prefetch 名额
+	c.b.mu.Unlock()
+
+	for _, e := range entries {
+		fn(e)
+	}
+	return nil
+}
+
+// deadLetter 转投到队列配置的死信队列，并记录死信原因
+func (c *memConsumer) deadLetter(msg Message, reason string) {
+	b := c.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, target := range c.q.deadLetter {
+		b.push(target, memEntry{msg: withDeath(copyMessage(msg), c.q.name, reason)})
+	}
+}
+
+func copyMessage(msg Message) Message {
+	headers := make(map[string]interface{}, len(msg.Headers))
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	msg.Headers = headers
+	msg.Body = append([]byte(nil), msg.Body...)
+	msg.Deaths = append([]Death(nil), msg.Deaths...)
+	return msg
+}
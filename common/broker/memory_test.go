@@ -0,0 +1,254 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"seckill-mall/common/mq"
+)
+
+const testWait = time.Second
+
+func newTestMemory(t *testing.T) *Memory {
+	t.Helper()
+	b := NewOrderMemory()
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func publish(t *testing.T, b *Memory, queue, id string) {
+	t.Helper()
+	if err := b.Publish(context.Background(), queue, Message{ID: id, Body: []byte(id)}); err != nil {
+		t.Fatalf("发布 %s 失败: %v", id, err)
+	}
+}
+
+func receive(t *testing.T, msgs <-chan Delivery) Delivery {
+	t.Helper()
+	select {
+	case d, ok := <-msgs:
+		if !ok {
+			t.Fatal("订阅通道已关闭")
+		}
+		return d
+	case <-time.After(testWait):
+		t.Fatal("等待消息超时")
+	}
+	return Delivery{}
+}
+
+func expectNone(t *testing.T, msgs <-chan Delivery, wait time.Duration) {
+	t.Helper()
+	select {
+	case d, ok := <-msgs:
+		if ok {
+			t.Fatalf("不应收到消息，收到 %s", d.ID)
+		}
+	case <-time.After(wait):
+	}
+}
+
+func TestMemoryAck(t *testing.T) {
+	b := newTestMemory(t)
+	msgs, stop := b.Consume(mq.OrderQueue, 1)
+	defer stop()
+
+	publish(t, b, mq.OrderQueue, "o1")
+	publish(t, b, mq.OrderQueue, "o2")
+
+	d := receive(t, msgs)
+	if d.ID != "o1" || d.Tag != 1 || d.Redelivered {
+		t.Fatalf("首条投递不符: id=%s tag=%d redelivered=%v", d.ID, d.Tag, d.Redelivered)
+	}
+	if err := d.Ack(); err != nil {
+		t.Fatalf("确认失败: %v", err)
+	}
+	// 重复确认与 RabbitMQ 一样报未知标签
+	if err := d.Ack(); err == nil {
+		t.Fatal("重复确认应返回错误")
+	}
+
+	d = receive(t, msgs)
+	if d.ID != "o2" || d.Tag != 2 {
+		t.Fatalf("第二条投递不符: id=%s tag=%d", d.ID, d.Tag)
+	}
+	d.Ack()
+	expectNone(t, msgs, 50*time.Millisecond)
+}
+
+func TestMemoryNackRequeue(t *testing.T) {
+	b := newTestMemory(t)
+	msgs, stop := b.Consume(mq.OrderQueue, 0)
+	defer stop()
+
+	publish(t, b, mq.OrderQueue, "o1")
+	publish(t, b, mq.OrderQueue, "o2")
+
+	d := receive(t, msgs)
+	if d.ID != "o1" {
+		t.Fatalf("期望 o1，收到 %s", d.ID)
+	}
+	// 放回队首：o2 已被取出等待投递，之后立即收到重新投递的 o1
+	if err := d.Nack(true); err != nil {
+		t.Fatalf("拒绝失败: %v", err)
+	}
+
+	seen := map[string]Delivery{}
+	for range 2 {
+		d := receive(t, msgs)
+		seen[d.ID] = d
+		d.Ack()
+	}
+	again, ok := seen["o1"]
+	if !ok {
+		t.Fatal("拒绝后消息没有重新投递")
+	}
+	if !again.Redelivered || again.DeliveryCount() != 1 {
+		t.Fatalf("重新投递标记不符: redelivered=%v count=%d", again.Redelivered, again.DeliveryCount())
+	}
+	if seen["o2"].Redelivered {
+		t.Fatal("o2 不应标记为重新投递")
+	}
+}
+
+func TestMemoryDeadLetter(t *testing.T) {
+	b := newTestMemory(t)
+	msgs, stop := b.Consume(mq.OrderQueue, 1)
+	defer stop()
+	dead, stopDead := b.Consume(mq.DeadQueue, 0)
+	defer stopDead()
+	comp, stopComp := b.Consume(mq.CompensationQueue, 0)
+	defer stopComp()
+
+	publish(t, b, mq.OrderQueue, "o1")
+	if err := receive(t, msgs).Nack(false); err != nil {
+		t.Fatalf("拒绝失败: %v", err)
+	}
+
+	// 订单队列的死信同时进入留档队列与补偿队列，并带上死信记录
+	for _, ch := range []<-chan Delivery{dead, comp} {
+		d := receive(t, ch)
+		if d.ID != "o1" {
+			t.Fatalf("死信消息不符: %s", d.ID)
+		}
+		if len(d.Deaths) != 1 || d.Deaths[0].Queue != mq.OrderQueue || d.Deaths[0].Reason != "rejected" || d.Deaths[0].Count != 1 {
+			t.Fatalf("死信记录不符: %+v", d.Deaths)
+		}
+		d.Ack()
+	}
+	expectNone(t, msgs, 50*time.Millisecond)
+
+	// 没有配置死信去向的队列拒绝后直接丢弃
+	publish(t, b, mq.CompensationQueue, "c1")
+	receive(t, comp).Nack(false)
+	expectNone(t, comp, 50*time.Millisecond)
+}
+
+func TestMemoryDelayed(t *testing.T) {
+	b := newTestMemory(t)
+	msgs, stop := b.Consume(mq.OrderQueue, 0)
+	defer stop()
+
+	const delay = 100 * time.Millisecond
+	start := time.Now()
+	err := b.PublishDelayed(context.Background(), mq.OrderQueue, Message{ID: "o1"}, delay)
+	if err != nil {
+		t.Fatalf("延迟发布失败: %v", err)
+	}
+	expectNone(t, msgs, delay/2)
+
+	d := receive(t, msgs)
+	if d.ID != "o1" {
+		t.Fatalf("延迟消息不符: %s", d.ID)
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Fatalf("延迟消息提前投递: %v", elapsed)
+	}
+	d.Ack()
+
+	// 与即时发布一样，目标队列不存在时立即返回 ErrUnroutable
+	if err := b.PublishDelayed(context.Background(), "missing", Message{ID: "x"}, delay); !errors.Is(err, ErrUnroutable) {
+		t.Fatalf("期望 ErrUnroutable，得到 %v", err)
+	}
+}
+
+func TestMemoryPrefetch(t *testing.T) {
+	b := newTestMemory(t)
+	msgs, stop := b.Consume(mq.OrderQueue, 2)
+	defer stop()
+
+	for _, id := range []string{"o1", "o2", "o3"} {
+		publish(t, b, mq.OrderQueue, id)
+	}
+
+	first := receive(t, msgs)
+	second := receive(t, msgs)
+	// 两条未确认时占满 prefetch，第三条不投递
+	expectNone(t, msgs, 50*time.Millisecond)
+
+	first.Ack()
+	third := receive(t, msgs)
+	if third.ID != "o3" {
+		t.Fatalf("期望 o3，收到 %s", third.ID)
+	}
+	expectNone(t, msgs, 50*time.Millisecond)
+	second.Ack()
+	third.Ack()
+}
+
+func TestMemoryStopRequeues(t *testing.T) {
+	b := NewOrderMemory()
+	msgs, stop := b.Consume(mq.OrderQueue, 0)
+
+	for _, id := range []string{"o1", "o2", "o3", "o4"} {
+		publish(t, b, mq.OrderQueue, id)
+	}
+	held := receive(t, msgs)
+	acked := receive(t, msgs)
+	// o3 已被取出等待交给订阅者，停止后原样放回队列
+	stop()
+	if _, ok := <-msgs; ok {
+		t.Fatal("停止后通道应已关闭")
+	}
+	// 已收到的消息停止订阅后仍可确认
+	if err := acked.Ack(); err != nil {
+		t.Fatalf("停止后确认失败: %v", err)
+	}
+
+	next, stopNext := b.Consume(mq.OrderQueue, 0)
+	for _, id := range []string{"o3", "o4"} {
+		d := receive(t, next)
+		if d.ID != id || d.Redelivered {
+			t.Fatalf("期望未交出的 %s 原样投递，收到 %s redelivered=%v", id, d.ID, d.Redelivered)
+		}
+		d.Ack()
+	}
+	expectNone(t, next, 50*time.Millisecond)
+	stopNext()
+
+	// 关闭 Broker 时仍未确认的消息放回队列并标记为重新投递
+	b.Close()
+	ready := b.queues[mq.OrderQueue].ready
+	if len(ready) != 1 || ready[0].msg.ID != held.ID || !ready[0].redelivered {
+		t.Fatalf("关闭后应只放回未确认的 %s，实际 %+v", held.ID, ready)
+	}
+	if err := held.Ack(); err == nil {
+		t.Fatal("放回队列后的旧标签不应再能确认")
+	}
+}
+
+func TestMemoryUnknownQueue(t *testing.T) {
+	b := newTestMemory(t)
+	msgs, stop := b.Consume("missing", 0)
+	defer stop()
+
+	if _, ok := <-msgs; ok {
+		t.Fatal("订阅不存在的队列应得到已关闭的通道")
+	}
+	// 订阅不会建出队列，发布仍然无法路由
+	if err := b.Publish(context.Background(), "missing", Message{ID: "x"}); !errors.Is(err, ErrUnroutable) {
+		t.Fatalf("期望 ErrUnroutable，得到 %v", err)
+	}
+}
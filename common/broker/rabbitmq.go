@@ -0,0 +1,247 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"seckill-mall/common/mq"
+)
+
+const (
+	// 等待 Broker 确认的最长时间
+	confirmTimeout = 5 * time.Second
+	// Broker 断线时发布方最多等待重连的时间
+	publishWaitTimeout = 2 * time.Second
+	// 默认发布连接数，即同时等待确认的消息数
+	DefaultPublisherPool = 8
+)
+
+// RabbitMQ 基于自动重连连接的实现：发布走开启确认的连接池，每个订阅使用独立连接以便单独设置 QoS
+type RabbitMQ struct {
+	url      string
+	name     string
+	topology func(ch *amqp.Channel) error
+
+	// 每个发布连接同一时刻只有一条消息等待确认，保证退回与确认能按顺序对应；
+	// 多个连接并行发布，吞吐不受单次确认往返时间限制
+	pubs []*publisher
+	pool chan *publisher
+
+	mu   sync.Mutex
+	subs []*mq.Connection
+}
+
+// publisher 连接池中的一个发布连接，同一时刻只被一个发布者持有
+type publisher struct {
+	conn *mq.Connection
+	// 已在哪个通道上声明过的延迟队列，重连后通道变化需重新声明
+	delayQueues map[string]*amqp.Channel
+}
+
+// NewRabbitMQ poolSize 为发布连接数，<=0 时使用 DefaultPublisherPool
+func NewRabbitMQ(url, name string, topology func(ch *amqp.Channel) error, poolSize int) *RabbitMQ {
+	if poolSize <= 0 {
+		poolSize = DefaultPublisherPool
+	}
+	r := &RabbitMQ{
+		url:      url,
+		name:     name,
+		topology: topology,
+		pool:     make(chan *publisher, poolSize),
+	}
+	for i := 0; i < poolSize; i++ {
+		p := &publisher{
+			conn: mq.NewConnection(url, mq.Options{
+				Name:        fmt.Sprintf("%s-publisher-%d", name, i),
+				Topology:    topology,
+				Confirm:     true,
+				WaitTimeout: publishWaitTimeout,
+			}),
+			delayQueues: map[string]*amqp.Channel{},
+		}
+		r.pubs = append(r.pubs, p)
+		r.pool <- p
+	}
+	return r
+}
+
+func (r *RabbitMQ) Publish(ctx context.Context, queue string, msg Message) error {
+	return r.publish(ctx, queue, msg, 0)
+}
+
+// PublishDelayed 投递到按延迟声明的 TTL 队列，过期后回到目标队列
+func (r *RabbitMQ) PublishDelayed(ctx context.Context, queue string, msg Message, delay time.Duration) error {
+	return r.publish(ctx, queue, msg, delay)
+}
+
+// publish 以 mandatory 方式发布并等待确认：被 nack、退回或确认超时都返回错误
+func (r *RabbitMQ) publish(ctx context.Context, queue string, msg Message, delay time.Duration) error {
+	var p *publisher
+	select {
+	case p = <-r.pool:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { r.pool <- p }()
+
+	session, err := p.conn.Session(ctx)
+	if err != nil {
+		return err
+	}
+	drainReturns(session.Returns, "")
+
+	routingKey := queue
+	if delay > 0 {
+		// 配置的重试延迟已随拓扑声明，这里只为未配置的延迟在每个通道上声明一次
+		routingKey = mq.RetryQueueName(queue, delay)
+		if p.delayQueues[routingKey] != session.Channel && !declaredDelay(queue, delay) {
+			if _, err := mq.DeclareDelayQueue(session.Channel, queue, delay); err != nil {
+				return err
+			}
+			p.delayQueues[routingKey] = session.Channel
+		}
+	}
+
+	dc, err := session.Channel.PublishWithDeferredConfirmWithContext(ctx,
+		"",         //默认交换机
+		routingKey, //队列名
+		true,       //mandatory: 无法路由时退回，而不是静默丢弃
+		false,
+		amqp.Publishing{
+			Headers:      amqp.Table(msg.Headers),
+			ContentType:  msg.ContentType,
+			Type:         msg.Type,
+			DeliveryMode: amqp.Persistent,
+			MessageId:    msg.ID,
+			Body:         msg.Body,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, confirmTimeout)
+	defer cancel()
+	acked, err := dc.WaitContext(waitCtx)
+	if err != nil {
+		return fmt.Errorf("等待 MQ 确认超时: %w", err)
+	}
+	if !acked {
+		return ErrNacked
+	}
+
+	// Broker 先发 basic.return 再发 basic.ack，收到确认时退回一定已在通道中
+	if drainReturns(session.Returns, msg.ID) {
+		return ErrUnroutable
+	}
+	return nil
+}
+
+// declaredDelay 订单队列的重试延迟是否已由拓扑声明
+func declaredDelay(queue string, delay time.Duration) bool {
+	if queue != mq.OrderQueue {
+		return false
+	}
+	for _, d := range mq.RetryDelays() {
+		if d == delay {
+			return true
+		}
+	}
+	return false
+}
+
+// drainReturns 取出通道中积压的退回消息，返回其中是否有指定消息
+func drainReturns(returns <-chan amqp.Return, id string) bool {
+	found := false
+	for {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				return found
+			}
+			if id != "" && r.MessageId == id {
+				found = true
+			}
+		default:
+			return found
+		}
+	}
+}
+
+func (r *RabbitMQ) Consume(queue string, prefetch int) (<-chan Delivery, func()) {
+	conn := mq.NewConnection(r.url, mq.Options{
+		Name:     r.name + "-" + queue,
+		Topology: r.topology,
+		Prefetch: prefetch,
+	})
+	r.mu.Lock()
+	r.subs = append(r.subs, conn)
+	r.mu.Unlock()
+
+	raw := conn.Consume(queue, "")
+	out := make(chan Delivery)
+	go func() {
+		defer close(out)
+		for d := range raw {
+			out <- fromAMQP(d)
+		}
+	}()
+	return out, conn.StopConsuming
+}
+
+func (r *RabbitMQ) Close() error {
+	r.mu.Lock()
+	subs := r.subs
+	r.subs = nil
+	r.mu.Unlock()
+
+	for _, c := range subs {
+		c.Close()
+	}
+	var err error
+	for _, p := range r.pubs {
+		if e := p.conn.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func fromAMQP(d amqp.Delivery) Delivery {
+	return Delivery{
+		Message: Message{
+			ID:          d.MessageId,
+			ContentType: d.ContentType,
+			Type:        d.Type,
+			Headers:     d.Headers,
+			Body:        d.Body,
+			Deaths:      parseDeaths(d.Headers),
+		},
+		Tag:         d.DeliveryTag,
+		Acker:       d.Acknowledger,
+		Redelivered: d.Redelivered,
+	}
+}
+
+// parseDeaths 解析 x-death 消息头
+func parseDeaths(headers amqp.Table) []Death {
+	items, _ := headers["x-death"].([]interface{})
+	deaths := make([]Death, 0, len(items))
+	for _, item := range items {
+		t, ok := item.(amqp.Table)
+		if !ok {
+			continue
+		}
+		var x Death
+		x.Queue, _ = t["queue"].(string)
+		x.Reason, _ = t["reason"].(string)
+		x.Count, _ = t["count"].(int64)
+		x.Time, _ = t["time"].(time.Time)
+		deaths = append(deaths, x)
+	}
+	return deaths
+}
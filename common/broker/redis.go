@@ -0,0 +1,615 @@
+package broker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisStreamPrefix  = "mq:stream:"  // 每个队列对应一个流
+	redisDelayedPrefix = "mq:delayed:" // 延迟消息有序集合，分数为到期时间(毫秒)
+	redisGroup         = "seckill"     // 每个流一个消费组，组内消费者竞争消费
+
+	defaultMaxDeliveries = 5
+	defaultClaimIdle     = 30 * time.Second
+	defaultStreamMaxLen  = 1000000
+
+	redisReadBlock      = time.Second
+	redisDefaultBatch   = 100 // prefetch 不限制时每次读取的条数
+	delayPollInterval   = 200 * time.Millisecond
+	maintainInterval    = time.Minute
+	idleConsumerTimeout = 24 * time.Hour
+	minRetryDelay       = 500 * time.Millisecond
+	maxRetryDelay       = 30 * time.Second
+)
+
+// 把到期的延迟消息原子地转移到目标流
+// KEYS[1] 延迟集合 KEYS[2] 目标流
+// ARGV[1] 当前时间(毫秒) ARGV[2] 每次最多转移条数 ARGV[3] 流长度上限，0 表示不限
+const moveDelayedLua = `
+local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, item in ipairs(items) do
+    local sep = string.find(item, '|', 1, true)
+    local body = string.sub(item, sep + 1)
+    if ARGV[3] == '0' then
+        redis.call('XADD', KEYS[2], '*', 'msg', body)
+    else
+        redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[3], '*', 'msg', body)
+    end
+    redis.call('ZREM', KEYS[1], item)
+end
+return #items
+`
+
+var moveDelayedScript = redis.NewScript(moveDelayedLua)
+
+// RedisOptions Redis Streams 实现的参数
+type RedisOptions struct {
+	MaxDeliveries int           // 同一条消息最多投递次数，仍未确认则转入死信流
+	ClaimIdle     time.Duration // 超过该时长未确认视为消费者卡死，由其他消费者认领
+	MaxLen        int64         // 留档流(Queue.Capped)的近似长度上限，防止无人消费的死信流无限增长
+}
+
+// RedisStreams 基于 Redis Streams 的实现，适合只部署了 Redis 的环境：
+// 每个队列一个流和一个消费组；消费者宕机后未确认的消息经 XPENDING/XCLAIM 由其他消费者认领，
+// 投递次数达到上限后转入死信流；已确认的消息定期按 MINID 裁剪，只有留档流另按长度裁剪。
+// Nack 放回队列时重新追加到流尾(Redis 流不支持插回队首)
+type RedisStreams struct {
+	rdb    *redis.Client
+	name   string
+	opts   RedisOptions
+	queues map[string]Queue
+	seq    atomic.Int64
+
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// redisEnvelope 流中每条消息只有一个 msg 字段，便于延迟消息整体转移
+type redisEnvelope struct {
+	Message
+	Redelivered bool `json:",omitempty"`
+}
+
+type redisEntry struct {
+	id  string
+	msg Message
+}
+
+// redisConsumer 一个订阅，同时充当该订阅上消息的 Acker
+type redisConsumer struct {
+	r          *RedisStreams
+	queue      string
+	stream     string
+	name       string
+	deadLetter []string
+	prefetch   int
+	out        chan Delivery
+
+	mu      sync.Mutex
+	nextTag uint64
+	unacked map[uint64]redisEntry
+	freed   chan struct{} // 确认后腾出 prefetch 名额
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewRedisStreams 创建 Redis Streams 实现，Close 时一并关闭 rdb
+func NewRedisStreams(rdb *redis.Client, name string, opts RedisOptions, queues ...Queue) *RedisStreams {
+	if opts.MaxDeliveries <= 0 {
+		opts.MaxDeliveries = defaultMaxDeliveries
+	}
+	if opts.ClaimIdle <= 0 {
+		opts.ClaimIdle = defaultClaimIdle
+	}
+	if opts.MaxLen <= 0 {
+		opts.MaxLen = defaultStreamMaxLen
+	}
+	r := &RedisStreams{
+		rdb:    rdb,
+		name:   name,
+		opts:   opts,
+		queues: map[string]Queue{},
+		stop:   make(chan struct{}),
+	}
+	for _, q := range queues {
+		r.queues[q.Name] = q
+	}
+
+	r.wg.Add(1)
+	go r.moveDelayed()
+	return r
+}
+
+func (r *RedisStreams) Publish(ctx context.Context, queue string, msg Message) error {
+	if err := r.check(queue); err != nil {
+		return err
+	}
+	data, err := json.Marshal(redisEnvelope{Message: msg})
+	if err != nil {
+		return err
+	}
+	return r.rdb.XAdd(ctx, r.xadd(queue, data)).Err()
+}
+
+// PublishDelayed 先写入延迟集合，到期后由后台协程转移到目标流
+func (r *RedisStreams) PublishDelayed(ctx context.Context, queue string, msg Message, delay time.Duration) error {
+	if delay <= 0 {
+		return r.Publish(ctx, queue, msg)
+	}
+	if err := r.check(queue); err != nil {
+		return err
+	}
+	data, err := json.Marshal(redisEnvelope{Message: msg})
+	if err != nil {
+		return err
+	}
+
+	// 加随机前缀，内容相同的两条延迟消息不会在有序集合中合并
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+	member := hex.EncodeToString(nonce) + "|" + string(data)
+	due := time.Now().Add(delay).UnixMilli()
+	return r.rdb.ZAdd(ctx, redisDelayedPrefix+queue, redis.Z{Score: float64(due), Member: member}).Err()
+}
+
+func (r *RedisStreams) check(queue string) error {
+	select {
+	case <-r.stop:
+		return ErrClosed
+	default:
+	}
+	if _, ok := r.queues[queue]; !ok {
+		return ErrUnroutable
+	}
+	return nil
+}
+
+func (r *RedisStreams) xadd(queue string, data []byte) *redis.XAddArgs {
+	return &redis.XAddArgs{
+		Stream: redisStreamPrefix + queue,
+		MaxLen: r.maxLen(queue),
+		Approx: true,
+		Values: []interface{}{"msg", data},
+	}
+}
+
+// maxLen 有人消费的流不按长度裁剪，否则积压时未投递或待确认的消息会被挤掉；0 表示不限
+func (r *RedisStreams) maxLen(queue string) int64 {
+	if r.queues[queue].Capped {
+		return r.opts.MaxLen
+	}
+	return 0
+}
+
+// moveDelayed 轮询各队列的延迟集合；多个进程同时转移也不会重复，脚本是原子的
+func (r *RedisStreams) moveDelayed() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(delayPollInterval)
+	defer ticker.Stop()
+
+	var lastErr string
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+		for queue := range r.queues {
+			keys := []string{redisDelayedPrefix + queue, redisStreamPrefix + queue}
+			err := moveDelayedScript.Run(context.Background(), r.rdb, keys, time.Now().UnixMilli(), 100, r.maxLen(queue)).Err()
+			// Redis 故障期间只记录一次，避免刷屏
+			if err != nil && err.Error() != lastErr {
+				log.Printf("转移延迟消息失败: %v", err)
+			}
+			if err != nil {
+				lastErr = err.Error()
+			} else {
+				lastErr = ""
+			}
+		}
+	}
+}
+
+func (r *RedisStreams) Consume(queue string, prefetch int) (<-chan Delivery, func()) {
+	host, _ := os.Hostname()
+	c := &redisConsumer{
+		r:          r,
+		queue:      queue,
+		stream:     redisStreamPrefix + queue,
+		name:       fmt.Sprintf("%s-%s-%d-%d", r.name, host, os.Getpid(), r.seq.Add(1)),
+		deadLetter: r.queues[queue].DeadLetter,
+		prefetch:   prefetch,
+		out:        make(chan Delivery),
+		unacked:    map[uint64]redisEntry{},
+		freed:      make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	r.wg.Add(1)
+	go c.run()
+	return c.out, c.stop
+}
+
+func (r *RedisStreams) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.stop)
+	})
+	r.wg.Wait()
+	return r.rdb.Close()
+}
+
+// run 消费循环：先认领超时未确认的消息，再读取新消息；Redis 故障时退避重试
+func (c *redisConsumer) run() {
+	defer c.r.wg.Done()
+	defer close(c.out)
+
+	ctx := context.Background()
+	backoff := minRetryDelay
+	var lastClaim, lastMaintain time.Time
+	groupReady := false
+	for {
+		n, ok := c.waitCredits()
+		if !ok {
+			return
+		}
+
+		var err error
+		if !groupReady {
+			err = c.ensureGroup(ctx)
+			groupReady = err == nil
+		}
+		if err == nil && time.Since(lastClaim) >= c.r.opts.ClaimIdle/2 {
+			lastClaim = time.Now()
+			err = c.recover(ctx, n)
+		}
+		if err == nil {
+			err = c.read(ctx, n)
+		}
+		if err == nil && time.Since(lastMaintain) >= maintainInterval {
+			lastMaintain = time.Now()
+			c.maintain(ctx)
+		}
+
+		if err != nil {
+			// 流被删除后消费组也会消失，下次重新创建
+			groupReady = false
+			log.Printf("Redis 流 %s 消费失败: %v，%v 后重试", c.stream, err, backoff)
+			if !c.sleep(backoff) {
+				return
+			}
+			backoff = min(backoff*2, maxRetryDelay)
+			continue
+		}
+		backoff = minRetryDelay
+	}
+}
+
+// waitCredits 等到有 prefetch 名额，返回本次最多读取的条数；停止后返回 false
+func (c *redisConsumer) waitCredits() (int, bool) {
+	for {
+		if c.stopped() {
+			return 0, false
+		}
+		if c.prefetch <= 0 {
+			return redisDefaultBatch, true
+		}
+		c.mu.Lock()
+		n := c.prefetch - len(c.unacked)
+		c.mu.Unlock()
+		if n > 0 {
+			return n, true
+		}
+		select {
+		case <-c.freed:
+		case <-c.done:
+		case <-c.r.stop:
+		}
+	}
+}
+
+func (c *redisConsumer) ensureGroup(ctx context.Context) error {
+	err := c.r.rdb.XGroupCreateMkStream(ctx, c.stream, redisGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+func (c *redisConsumer) read(ctx context.Context, n int) error {
+	streams, err := c.r.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    redisGroup,
+		Consumer: c.name,
+		Streams:  []string{c.stream, ">"},
+		Count:    int64(n),
+		Block:    redisReadBlock,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, s := range streams {
+		for _, m := range s.Messages {
+			if !c.deliver(ctx, m, 0) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// recover 认领其他消费者(宕机或卡死)超时未确认的消息；已投递次数达到上限的转入死信流
+func (c *redisConsumer) recover(ctx context.Context, n int) error {
+	pending, err := c.r.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: c.stream,
+		Group:  redisGroup,
+		Idle:   c.r.opts.ClaimIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  int64(n),
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+
+	ids := make([]string, 0, len(pending))
+	deliveries := make(map[string]int64, len(pending))
+	for _, p := range pending {
+		ids = append(ids, p.ID)
+		deliveries[p.ID] = p.RetryCount
+	}
+	claimed, err := c.r.rdb.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   c.stream,
+		Group:    redisGroup,
+		Consumer: c.name,
+		MinIdle:  c.r.opts.ClaimIdle, // 期间已被别人认领或确认的消息会被跳过
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range claimed {
+		// 自己处理超时的消息也会被重新认领，旧标签作废，避免一直占用 prefetch 名额
+		c.forget(m.ID)
+		if len(m.Values) == 0 {
+			// 消息已被裁剪，只剩待确认记录(只会发生在按长度裁剪的留档流上)
+			log.Printf("⚠️ 流 %s 中待确认的消息 %s 已被裁剪", c.stream, m.ID)
+			c.r.rdb.XAck(ctx, c.stream, redisGroup, m.ID)
+			continue
+		}
+		if count := deliveries[m.ID]; count >= int64(c.r.opts.MaxDeliveries) {
+			msg, _, _ := decodeRedisMessage(m.Values)
+			log.Printf("🚨 [ALERT] 流 %s 的消息 %s 已投递 %d 次仍未确认，转入死信", c.stream, m.ID, count)
+			if err := c.reject(ctx, m.ID, msg, "delivery_limit"); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Printf("♻️ 认领流 %s 中超时未确认的消息 %s (第%d次投递)", c.stream, m.ID, deliveries[m.ID]+1)
+		if !c.deliver(ctx, m, deliveries[m.ID]) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// deliver 登记投递标签后推给订阅者，delivered 为该条目此前已投递的次数(认领时由 XPENDING 得到)
+// 已停止时返回 false，消息留在待确认列表由其他消费者认领
+func (c *redisConsumer) deliver(ctx context.Context, m redis.XMessage, delivered int64) bool {
+	msg, requeued, err := decodeRedisMessage(m.Values)
+	if err != nil {
+		log.Printf("流 %s 的消息 %s 格式错误: %v", c.stream, m.ID, err)
+	}
+	if delivered > 0 {
+		msg = addDeliveries(msg, int(delivered))
+	}
+
+	c.mu.Lock()
+	c.nextTag++
+	tag := c.nextTag
+	c.unacked[tag] = redisEntry{id: m.ID, msg: msg}
+	c.mu.Unlock()
+
+	d := Delivery{Message: msg, Tag: tag, Acker: c, Redelivered: delivered > 0 || requeued}
+	select {
+	case c.out <- d:
+		return true
+	case <-c.done:
+	case <-c.r.stop:
+	}
+	c.mu.Lock()
+	delete(c.unacked, tag)
+	c.mu.Unlock()
+	return false
+}
+
+// maintain 裁剪已被确认的消息，清理长期空闲且没有待确认消息的消费者
+func (c *redisConsumer) maintain(ctx context.Context) {
+	rdb := c.r.rdb
+	groups, err := rdb.XInfoGroups(ctx, c.stream).Result()
+	if err != nil {
+		return
+	}
+	minID := ""
+	for _, g := range groups {
+		if g.Name == redisGroup {
+			minID = g.LastDeliveredID
+		}
+	}
+	// 最早的待确认消息之前的都已确认，可以裁掉
+	if p, err := rdb.XPending(ctx, c.stream, redisGroup).Result(); err == nil && p.Count > 0 {
+		minID = p.Lower
+	}
+	if minID != "" && minID != "0-0" {
+		if err := rdb.XTrimMinIDApprox(ctx, c.stream, minID, 0).Err(); err != nil {
+			log.Printf("裁剪流 %s 失败: %v", c.stream, err)
+		}
+	}
+
+	consumers, err := rdb.XInfoConsumers(ctx, c.stream, redisGroup).Result()
+	if err != nil {
+		return
+	}
+	for _, cs := range consumers {
+		if cs.Name != c.name && cs.Pending == 0 && cs.Idle > idleConsumerTimeout {
+			rdb.XGroupDelConsumer(ctx, c.stream, redisGroup, cs.Name)
+		}
+	}
+}
+
+func (c *redisConsumer) Ack(tag uint64, multiple bool) error {
+	entries, err := c.take(tag, multiple)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.id)
+	}
+	// 确认失败的消息仍在待确认列表中，超时后会被重新投递
+	return c.r.rdb.XAck(context.Background(), c.stream, redisGroup, ids...).Err()
+}
+
+func (c *redisConsumer) Nack(tag uint64, multiple, requeue bool) error {
+	entries, err := c.take(tag, multiple)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	for _, e := range entries {
+		if requeue {
+			err = c.requeue(ctx, e.id, e.msg)
+		} else {
+			err = c.reject(ctx, e.id, e.msg, "rejected")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// take 按标签取出未确认的消息；与 RabbitMQ 一样，未知标签返回错误
+func (c *redisConsumer) take(tag uint64, multiple bool) ([]redisEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.unacked[tag]; !ok {
+		return nil, fmt.Errorf("未知的投递标签 %d", tag)
+	}
+
+	tags := []uint64{tag}
+	if multiple {
+		tags = tags[:0]
+		for t := range c.unacked {
+			if t <= tag {
+				tags = append(tags, t)
+			}
+		}
+		slices.Sort(tags)
+	}
+	entries := make([]redisEntry, 0, len(tags))
+	for _, t := range tags {
+		entries = append(entries, c.unacked[t])
+		delete(c.unacked, t)
+	}
+
+	select {
+	case c.freed <- struct{}{}:
+	default:
+	}
+	return entries, nil
+}
+
+// forget 丢弃指定消息的未确认登记
+func (c *redisConsumer) forget(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for tag, e := range c.unacked {
+		if e.id == id {
+			delete(c.unacked, tag)
+		}
+	}
+}
+
+// requeue 重新追加到流尾并确认原消息
+func (c *redisConsumer) requeue(ctx context.Context, id string, msg Message) error {
+	data, err := json.Marshal(redisEnvelope{Message: addDeliveries(msg, 1), Redelivered: true})
+	if err != nil {
+		return err
+	}
+	pipe := c.r.rdb.TxPipeline()
+	pipe.XAdd(ctx, c.r.xadd(c.queue, data))
+	pipe.XAck(ctx, c.stream, redisGroup, id)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// reject 转投到队列配置的死信流并确认原消息，两步在同一事务中完成
+func (c *redisConsumer) reject(ctx context.Context, id string, msg Message, reason string) error {
+	pipe := c.r.rdb.TxPipeline()
+	for _, target := range c.deadLetter {
+		data, err := json.Marshal(redisEnvelope{Message: withDeath(msg, c.queue, reason)})
+		if err != nil {
+			return err
+		}
+		pipe.XAdd(ctx, c.r.xadd(target, data))
+	}
+	pipe.XAck(ctx, c.stream, redisGroup, id)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (c *redisConsumer) stop() {
+	c.stopOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+func (c *redisConsumer) stopped() bool {
+	select {
+	case <-c.done:
+		return true
+	case <-c.r.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *redisConsumer) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-c.done:
+		return false
+	case <-c.r.stop:
+		return false
+	}
+}
+
+// decodeRedisMessage 解析流中的消息；无法解析时原样作为消息体返回，交给业务方按格式错误处理
+func decodeRedisMessage(values map[string]interface{}) (Message, bool, error) {
+	raw, _ := values["msg"].(string)
+	var env redisEnvelope
+	if err := json.Unmarshal([]byte(raw), &env); err != nil {
+		return Message{Body: []byte(raw)}, false, err
+	}
+	return env.Message, env.Redelivered, nil
+}
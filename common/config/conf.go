@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -13,6 +14,10 @@ type Config struct {
 	Etcd    EtcdConfig    `mapstructure:"etcd"`
 	Seckill SeckillConfig `mapstructure:"seckill"`
 	JWT     JWTConfig     `mapstructure:"jwt"`
+	MQ      MQConfig      `mapstructure:"mq"`
+	Auth    AuthConfig    `mapstructure:"auth"`
+
+	RateLimits []RateLimitConfig `mapstructure:"rate_limits"`
 }
 
 type ServerConfig struct {
@@ -20,6 +25,8 @@ type ServerConfig struct {
 	Mode        string `mapstructure:"mode"`
 	Port        string `mapstructure:"port" yaml:"port"`
 	MetricsPort string `mapstructure:"metrics_port"`
+
+	TrustedProxies []string `mapstructure:"trusted_proxies"` //网关信任的反向代理(IP 或 CIDR)，只有经它们转发的 X-Forwarded-For 才会被采信
 }
 
 type MySQLConfig struct {
@@ -37,12 +44,64 @@ type EtcdConfig struct {
 }
 
 type SeckillConfig struct {
-	PurchaseLimit int64 `mapstructure:"purchase_limit"`
+	PurchaseLimit  int64         `mapstructure:"purchase_limit"`
+	PreheatMinutes int           `mapstructure:"preheat_minutes"` //活动开始前多少分钟预热，活动可单独覆盖
+	PathTTL        time.Duration `mapstructure:"path_ttl"`        //网关发放的秒杀地址有效期，默认 30s
+	// 获取秒杀地址前的人机挑战，活动可单独覆盖
+	Challenge           string        `mapstructure:"challenge"`            //pow(默认)、image、none 或 math(仅开发调试，release 模式拒绝)
+	ChallengeDifficulty int           `mapstructure:"challenge_difficulty"` //math/image: 1~3，pow: 前导 0 位数
+	ChallengeTTL        time.Duration `mapstructure:"challenge_ttl"`        //题目有效期，默认 2m
+}
+
+type MQConfig struct {
+	Backend       string          `mapstructure:"backend"`        //rabbitmq(默认)、redis ；memory 仅供进程内测试，服务拒绝使用
+	URL           string          `mapstructure:"url"`            //RabbitMQ 地址
+	PublisherPool int             `mapstructure:"publisher_pool"` //RabbitMQ 发布连接数，即同时等待确认的消息数，默认 8
+	RetryDelays   []time.Duration `mapstructure:"retry_delays"`   //逐次重试的延迟，如 ["1s", "5s", "30s"]
+	MaxAttempts   int             `mapstructure:"max_attempts"`   //含首次消费在内的最多处理次数，超过后进入死信
+	Prefetch      int             `mapstructure:"prefetch"`       //消费者 QoS
+	Workers       int             `mapstructure:"workers"`        //落库工作协程数
+	BatchSize     int             `mapstructure:"batch_size"`     //每批落库条数
+	BatchWait     time.Duration   `mapstructure:"batch_wait"`     //攒批最长等待时间
+	QueueType     string          `mapstructure:"queue_type"`     //RabbitMQ 订单队列类型：classic(默认) 或 quorum
+	DeliveryLimit int             `mapstructure:"delivery_limit"` //同一消息最多投递次数，超过后移入隔离队列
+	// Redis Streams 专用
+	MaxDeliveries int           `mapstructure:"max_deliveries"` //同一消息最多投递次数，仍未确认则转入死信流(兜底，应大于 delivery_limit)
+	ClaimIdle     time.Duration `mapstructure:"claim_idle"`     //消息超过该时长未确认，由其他消费者认领
+	StreamMaxLen  int64         `mapstructure:"stream_max_len"` //死信留档流的近似长度上限，订单与补偿流不按长度裁剪
 }
 
 type JWTConfig struct {
-	Expire string `mapstructure:"expire"` //对应 yaml 里的 "24h"
-	Secret string `mapstructure:"secret"`
+	Expire        string         `mapstructure:"expire"`         //访问令牌有效期，对应 yaml 里的 "15m"
+	RefreshExpire string         `mapstructure:"refresh_expire"` //刷新令牌有效期，每次刷新后重新计时
+	Secret        string         `mapstructure:"secret"`         //未配置 keys 时作为 HS256 密钥(兼容旧配置)
+	Issuer        string         `mapstructure:"issuer"`         //签发方 iss，默认 seckill-app
+	Audience      string         `mapstructure:"audience"`       //受众 aud，默认 seckill-mall
+	ActiveKid     string         `mapstructure:"active_kid"`     //当前用于签名的密钥，其余密钥只用于验签
+	Keys          []JWTKeyConfig `mapstructure:"keys"`
+}
+
+type JWTKeyConfig struct {
+	Kid            string `mapstructure:"kid"`
+	Alg            string `mapstructure:"alg"`              //HS256(默认)、RS256 或 EdDSA
+	Secret         string `mapstructure:"secret"`           //HS256 密钥
+	SecretFile     string `mapstructure:"secret_file"`      //从文件读取 HS256 密钥，优先于 secret
+	PrivateKeyFile string `mapstructure:"private_key_file"` //RS256/EdDSA 私钥(PEM)，签名密钥必填
+	PublicKeyFile  string `mapstructure:"public_key_file"`  //RS256/EdDSA 公钥(PEM)，仅验签的旧密钥可只配公钥
+}
+
+// RateLimitConfig 网关单个资源的限流规则，阈值为 0 表示不限
+type RateLimitConfig struct {
+	Resource    string   `mapstructure:"resource"`
+	QPS         float64  `mapstructure:"qps"`          //资源整体每秒请求数
+	PerUser     int64    `mapstructure:"per_user"`     //每个用户在统计周期内的请求数(需登录的接口)
+	PerIP       int64    `mapstructure:"per_ip"`       //每个客户端IP在统计周期内的请求数
+	DurationSec int64    `mapstructure:"duration_sec"` //热点参数统计周期，默认 1 秒
+	ExemptIPs   []string `mapstructure:"exempt_ips"`   //不做IP限流的地址，如压测机、内网探活
+}
+
+type AuthConfig struct {
+	MockLogin bool `mapstructure:"mock_login"` //仅开发/压测使用(默认关闭)：允许 /login 直接按 user_id 签发 Token，release 模式下不生效
 }
 
 // 全局配置变量
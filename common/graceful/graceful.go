@@ -0,0 +1,63 @@
+package graceful
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Timeout 每个关闭阶段的最长等待时间，超时后强制结束，避免进程卡住无法退出
+const Timeout = 10 * time.Second
+
+// WaitSignal 阻塞直到收到 SIGINT / SIGTERM
+func WaitSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-ch
+	signal.Stop(ch)
+	log.Printf("收到信号 %v，开始优雅关闭...", sig)
+}
+
+// StopGRPC 停止接收新请求并等待进行中的调用完成，超时后强制关闭
+func StopGRPC(s *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(Timeout):
+		log.Printf("gRPC 请求在 %v 内未处理完，强制关闭", Timeout)
+		s.Stop()
+	}
+}
+
+// Wait 等待后台任务退出，超时返回 false
+func Wait(wg *sync.WaitGroup, name string) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(Timeout):
+		log.Printf("%s 在 %v 内未退出，放弃等待", name, Timeout)
+		return false
+	}
+}
+
+// Context 关闭阶段使用的带超时 Context
+func Context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), Timeout)
+}
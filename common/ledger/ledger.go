@@ -0,0 +1,143 @@
+package ledger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	// Redis Stream 流水 Key，所有库存变更都在 Lua 脚本里原子追加到这里
+	StreamKey = "inventory:ledger"
+	// 落库消费者组
+	GroupName = "ledger-drainer"
+
+	// 按订单记录扣减状态(deducted/rolledback，落库后由消费者回写为 created)，保证同一订单的扣减与回滚各只生效一次
+	OrderStateKeyPrefix = "inventory:order:"
+	OrderStateTTL       = 7 * 24 * time.Hour
+)
+
+// 库存变更原因
+const (
+	ReasonDeduct   = "deduct"   // 秒杀扣减
+	ReasonRollback = "rollback" // 下单失败回滚
+	ReasonWaitlist = "waitlist" // 回流库存分配给候补用户
+	ReasonRaffle   = "raffle"   // 抽签中签扣减
+	ReasonPreheat  = "preheat"  // 活动预热，stock_after 为重置后的库存，用户购买记录清零
+	ReasonCleanup  = "cleanup"  // 活动结束清理 Redis
+	ReasonWave     = "wave"     // 分波放量，delta 为 0，不改变库存总量
+)
+
+// Entry 库存流水(只追加，不修改)
+type Entry struct {
+	ID uint64 `gorm:"column:id;primaryKey;autoIncrement"`
+	// Redis Stream 消息ID，唯一索引保证重复落库幂等
+	StreamID string `gorm:"column:stream_id;type:varchar(32);uniqueIndex;not null"`
+	// Stream ID(毫秒时间戳-序号)拆成两个整数列，按 (stream_ms, stream_seq) 排序才是写入顺序；
+	// stream_id 是字符串，按字典序会把同一毫秒内的 -10 排在 -2 之前
+	StreamMs   int64     `gorm:"column:stream_ms;not null;default:0;index:idx_ledger_stream_order,priority:1"`
+	StreamSeq  int64     `gorm:"column:stream_seq;not null;default:0;index:idx_ledger_stream_order,priority:2"`
+	ProductID  int64     `gorm:"column:product_id;index;not null"`
+	UserID     int64     `gorm:"column:user_id;index"`
+	OrderID    string    `gorm:"column:order_id;type:varchar(64);index"`
+	Delta      int64     `gorm:"column:delta;not null"`      // 库存变化量，扣减为负
+	UserDelta  int64     `gorm:"column:user_delta;not null"` // 用户已购数量变化量
+	StockAfter int64     `gorm:"column:stock_after"`         // 变更后的库存，便于排查
+	Reason     string    `gorm:"column:reason;type:varchar(32);not null"`
+	CreatedAt  time.Time `gorm:"column:created_at"` // 取自 Stream ID 的毫秒时间戳
+}
+
+func (Entry) TableName() string { return "inventory_ledger" }
+
+// Before 流水 e 是否写在 o 之前
+func (e *Entry) Before(o *Entry) bool {
+	if e.StreamMs != o.StreamMs {
+		return e.StreamMs < o.StreamMs
+	}
+	return e.StreamSeq < o.StreamSeq
+}
+
+// ParseStreamID 把 Stream ID 拆成毫秒时间戳与序号
+func ParseStreamID(id string) (ms, seq int64, err error) {
+	msPart, seqPart, ok := strings.Cut(id, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("非法的流水ID %s", id)
+	}
+	if ms, err = strconv.ParseInt(msPart, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("非法的流水ID %s: %v", id, err)
+	}
+	if seq, err = strconv.ParseInt(seqPart, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("非法的流水ID %s: %v", id, err)
+	}
+	return ms, seq, nil
+}
+
+// BackfillStreamOrder 为新增排序列之前落库的流水补上 stream_ms/stream_seq
+func BackfillStreamOrder(db *gorm.DB) error {
+	var lastID uint64
+	for {
+		var batch []Entry
+		err := db.Select("id", "stream_id").Where("stream_ms = 0 AND id > ?", lastID).
+			Order("id").Limit(1000).Find(&batch).Error
+		if err != nil || len(batch) == 0 {
+			return err
+		}
+		for _, e := range batch {
+			lastID = e.ID
+			ms, seq, err := ParseStreamID(e.StreamID)
+			if err != nil {
+				return err
+			}
+			err = db.Model(&Entry{}).Where("id = ?", e.ID).
+				Updates(map[string]interface{}{"stream_ms": ms, "stream_seq": seq}).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// FromMessage 把 Stream 消息还原成流水记录
+func FromMessage(msg redis.XMessage) (*Entry, error) {
+	ms, seq, err := ParseStreamID(msg.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Entry{
+		StreamID:  msg.ID,
+		StreamMs:  ms,
+		StreamSeq: seq,
+		OrderID:   field(msg, "order_id"),
+		Reason:    field(msg, "reason"),
+		CreatedAt: time.UnixMilli(ms),
+	}
+
+	ints := []struct {
+		name string
+		dst  *int64
+	}{
+		{"product_id", &e.ProductID},
+		{"user_id", &e.UserID},
+		{"delta", &e.Delta},
+		{"user_delta", &e.UserDelta},
+		{"stock_after", &e.StockAfter},
+	}
+	for _, f := range ints {
+		v, err := strconv.ParseInt(field(msg, f.name), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("流水 %s 字段 %s 解析失败: %v", msg.ID, f.name, err)
+		}
+		*f.dst = v
+	}
+	return e, nil
+}
+
+func field(msg redis.XMessage, name string) string {
+	v, _ := msg.Values[name].(string)
+	return v
+}
@@ -0,0 +1,287 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	minReconnectDelay = 500 * time.Millisecond
+	maxReconnectDelay = 30 * time.Second
+)
+
+var (
+	ErrNotConnected = errors.New("RabbitMQ 未连接")
+	ErrClosed       = errors.New("RabbitMQ 连接已关闭")
+)
+
+// Options 连接管理器配置
+type Options struct {
+	Name     string                       // 日志中的连接名
+	Topology func(ch *amqp.Channel) error // 每次(重)连成功后声明交换机/队列
+	Confirm  bool                         // 通道开启发布确认
+	Prefetch int                          // 消费者 QoS，0 表示不限制
+	// 断线时 Session 的最长等待时间，超过后返回 ErrNotConnected；0 表示立即失败
+	WaitTimeout time.Duration
+}
+
+// Session 一次连接上的通道，断线重连后会换成新的 Session
+type Session struct {
+	Channel *amqp.Channel
+	// 开启 mandatory 发布时被退回的消息，与该通道的确认按顺序到达
+	Returns <-chan amqp.Return
+}
+
+type consumer struct {
+	queue string
+	name  string
+	out   chan amqp.Delivery
+}
+
+// Connection 自动重连的 RabbitMQ 连接：断线后按退避重连、重新声明拓扑、恢复 QoS 与消费者
+type Connection struct {
+	url  string
+	opts Options
+
+	mu        sync.Mutex
+	conn      *amqp.Connection
+	session   *Session
+	ready     chan struct{} // 连接就绪时关闭，断线后换成新的
+	consumers []*consumer
+	forwards  sync.WaitGroup
+	closed    bool
+}
+
+// NewConnection 创建连接管理器并在后台建立连接，不会因为 Broker 暂时不可用而退出
+func NewConnection(url string, opts Options) *Connection {
+	if opts.Name == "" {
+		opts.Name = "rabbitmq"
+	}
+	c := &Connection{url: url, opts: opts, ready: make(chan struct{})}
+	go c.run()
+	return c
+}
+
+// Session 获取当前可用的通道，断线时按 WaitTimeout 等待重连
+func (c *Connection) Session(ctx context.Context) (*Session, error) {
+	var timeout <-chan time.Time
+	if c.opts.WaitTimeout > 0 {
+		timer := time.NewTimer(c.opts.WaitTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		c.mu.Lock()
+		s, ready, closed := c.session, c.ready, c.closed
+		c.mu.Unlock()
+
+		if closed {
+			return nil, ErrClosed
+		}
+		if s != nil {
+			return s, nil
+		}
+		if timeout == nil {
+			return nil, ErrNotConnected
+		}
+
+		select {
+		case <-ready:
+		case <-timeout:
+			return nil, ErrNotConnected
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Consume 订阅队列，返回的通道跨重连保持不变，连接关闭后才会关闭
+// 重连前未确认的消息会由 Broker 重新投递，旧消息 Ack 失败可以忽略
+func (c *Connection) Consume(queue, name string) <-chan amqp.Delivery {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 显式指定消费者标签，停止消费时按标签取消
+	if name == "" {
+		name = fmt.Sprintf("%s-%s-%d", c.opts.Name, queue, len(c.consumers)+1)
+	}
+	cs := &consumer{queue: queue, name: name, out: make(chan amqp.Delivery)}
+	c.consumers = append(c.consumers, cs)
+	if c.session != nil {
+		if err := c.startConsumer(c.session.Channel, cs); err != nil {
+			// 启动失败说明通道已坏，等待重连后恢复
+			log.Printf("[%s] 订阅队列 %s 失败，重连后重试: %v", c.opts.Name, queue, err)
+		}
+	}
+	return cs.out
+}
+
+// StopConsuming 取消全部消费者，不再接收新消息；已收到的消息仍可在 Close 前确认
+// 转发完 Broker 已推送的消息后关闭消费者通道
+func (c *Connection) StopConsuming() {
+	c.mu.Lock()
+	consumers := c.consumers
+	c.consumers = nil
+	s := c.session
+	c.mu.Unlock()
+
+	if s != nil {
+		for _, cs := range consumers {
+			if err := s.Channel.Cancel(cs.name, false); err != nil {
+				log.Printf("[%s] 取消消费者 %s 失败: %v", c.opts.Name, cs.name, err)
+			}
+		}
+	}
+	c.forwards.Wait()
+	for _, cs := range consumers {
+		close(cs.out)
+	}
+}
+
+// Close 关闭连接，不再重连
+func (c *Connection) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn != nil {
+		return conn.Close()
+	}
+	return nil
+}
+
+func (c *Connection) run() {
+	delay := minReconnectDelay
+	for {
+		conn, s, err := c.dial()
+		if err != nil {
+			if c.isClosed() {
+				c.shutdown()
+				return
+			}
+			log.Printf("[%s] 连接 RabbitMQ 失败，%v 后重试: %v", c.opts.Name, delay, err)
+			time.Sleep(delay)
+			delay = min(delay*2, maxReconnectDelay)
+			continue
+		}
+		delay = minReconnectDelay
+
+		connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		chClosed := s.Channel.NotifyClose(make(chan *amqp.Error, 1))
+
+		if !c.setSession(conn, s) {
+			conn.Close()
+			c.shutdown()
+			return
+		}
+		log.Printf("[%s] 已连接到 RabbitMQ", c.opts.Name)
+
+		var reason *amqp.Error
+		select {
+		case reason = <-connClosed:
+		case reason = <-chClosed:
+		}
+
+		c.mu.Lock()
+		c.conn, c.session = nil, nil
+		c.ready = make(chan struct{})
+		c.mu.Unlock()
+		conn.Close()
+
+		if c.isClosed() {
+			c.shutdown()
+			return
+		}
+		log.Printf("[%s] RabbitMQ 连接断开，准备重连: %v", c.opts.Name, reason)
+	}
+}
+
+// dial 建立连接与通道，并恢复拓扑、QoS 与确认模式
+func (c *Connection) dial() (*amqp.Connection, *Session, error) {
+	conn, err := amqp.Dial(c.url)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ch, err := conn.Channel()
+	if err == nil && c.opts.Prefetch > 0 {
+		err = ch.Qos(c.opts.Prefetch, 0, false)
+	}
+	if err == nil && c.opts.Topology != nil {
+		err = c.opts.Topology(ch)
+	}
+	if err == nil && c.opts.Confirm {
+		err = ch.Confirm(false)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	returns := ch.NotifyReturn(make(chan amqp.Return, 16))
+	return conn, &Session{Channel: ch, Returns: returns}, nil
+}
+
+// setSession 发布新 Session 并恢复消费者，连接已关闭时返回 false
+func (c *Connection) setSession(conn *amqp.Connection, s *Session) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+
+	c.conn, c.session = conn, s
+	for _, cs := range c.consumers {
+		if err := c.startConsumer(s.Channel, cs); err != nil {
+			log.Printf("[%s] 恢复队列 %s 的消费者失败: %v", c.opts.Name, cs.queue, err)
+		}
+	}
+	close(c.ready)
+	return true
+}
+
+// startConsumer 在通道上订阅队列，把消息转发到消费者的固定通道，调用方持有锁
+func (c *Connection) startConsumer(ch *amqp.Channel, cs *consumer) error {
+	msgs, err := ch.Consume(cs.queue, cs.name, false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	c.forwards.Add(1)
+	go func() {
+		defer c.forwards.Done()
+		for d := range msgs {
+			cs.out <- d
+		}
+	}()
+	return nil
+}
+
+func (c *Connection) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// shutdown 连接关闭后等转发协程退出，再关闭消费者通道
+func (c *Connection) shutdown() {
+	c.forwards.Wait()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cs := range c.consumers {
+		close(cs.out)
+	}
+	c.consumers = nil
+}
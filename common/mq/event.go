@@ -0,0 +1,81 @@
+package mq
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"seckill-mall/common/pb"
+)
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+
+	// OrderEventType 写入 AMQP type 属性，标明消息体的 protobuf 类型
+	OrderEventType = "order.OrderCreatedEvent"
+	// OrderEventVersion 当前发布的事件版本
+	OrderEventVersion = 1
+)
+
+// legacyOrderMessage 迁移前的 JSON 消息结构，只用于解码旧消息
+type legacyOrderMessage struct {
+	OrderID   string  `json:"order_id"`
+	UserID    int64   `json:"user_id"`
+	ProductID int64   `json:"product_id"`
+	Amount    float32 `json:"amount"`
+}
+
+// NewOrderEvent 构造当前版本的订单创建事件
+func NewOrderEvent(orderID string, userID, productID int64, count int32, amount float32) *pb.OrderCreatedEvent {
+	return &pb.OrderCreatedEvent{
+		Version:   OrderEventVersion,
+		OrderId:   orderID,
+		UserId:    userID,
+		ProductId: productID,
+		Count:     count,
+		Amount:    amount,
+		CreatedAt: time.Now().Unix(),
+	}
+}
+
+// EncodeOrderEvent 把事件编码为 protobuf，content-type 为 ContentTypeProtobuf
+func EncodeOrderEvent(e *pb.OrderCreatedEvent) ([]byte, error) {
+	return proto.Marshal(e)
+}
+
+// DecodeOrderEvent 按 content-type 解码订单事件，迁移期间同时支持旧版 JSON 与 protobuf
+func DecodeOrderEvent(contentType string, body []byte) (*pb.OrderCreatedEvent, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case ContentTypeProtobuf:
+		e := &pb.OrderCreatedEvent{}
+		if err := proto.Unmarshal(body, e); err != nil {
+			return nil, err
+		}
+		if e.OrderId == "" {
+			return nil, fmt.Errorf("订单事件缺少订单号")
+		}
+		return e, nil
+
+	case ContentTypeJSON, "":
+		var m legacyOrderMessage
+		if err := json.Unmarshal(body, &m); err != nil {
+			return nil, err
+		}
+		if m.OrderID == "" {
+			return nil, fmt.Errorf("订单消息缺少订单号")
+		}
+		// 旧消息没有数量与版本，版本记为 0
+		return &pb.OrderCreatedEvent{
+			OrderId:   m.OrderID,
+			UserId:    m.UserID,
+			ProductId: m.ProductID,
+			Amount:    m.Amount,
+		}, nil
+	}
+	return nil, fmt.Errorf("不支持的消息类型: %s", contentType)
+}
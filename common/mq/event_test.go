@@ -0,0 +1,99 @@
+package mq_test
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	"seckill-mall/common/broker"
+	"seckill-mall/common/mq"
+	"seckill-mall/common/pb"
+)
+
+func TestDecodeOrderEvent(t *testing.T) {
+	event := &pb.OrderCreatedEvent{
+		Version:   mq.OrderEventVersion,
+		OrderId:   "o1",
+		UserId:    7,
+		ProductId: 42,
+		Amount:    99.5,
+		Count:     2,
+		CreatedAt: 1700000000,
+	}
+	body, err := mq.EncodeOrderEvent(event)
+	if err != nil {
+		t.Fatalf("编码失败: %v", err)
+	}
+	// 新版本追加的字段(字段号 99)，旧消费者应跳过而不报错
+	future := protowire.AppendTag(append([]byte(nil), body...), 99, protowire.BytesType)
+	future = protowire.AppendString(future, "未来字段")
+
+	legacyJSON := []byte(`{"order_id":"o1","user_id":7,"product_id":42,"amount":99.5}`)
+	legacyEvent := &pb.OrderCreatedEvent{OrderId: "o1", UserId: 7, ProductId: 42, Amount: 99.5}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		want        *pb.OrderCreatedEvent
+		wantErr     bool
+	}{
+		{name: "旧版 JSON", contentType: mq.ContentTypeJSON, body: legacyJSON, want: legacyEvent},
+		{name: "旧版 JSON 带 charset", contentType: "application/json; charset=utf-8", body: legacyJSON, want: legacyEvent},
+		{name: "旧版 JSON 缺少 content-type", contentType: "", body: legacyJSON, want: legacyEvent},
+		{
+			name:        "旧版 JSON 带未知字段",
+			contentType: mq.ContentTypeJSON,
+			body:        []byte(`{"order_id":"o1","user_id":7,"product_id":42,"amount":99.5,"coupon":"c1"}`),
+			want:        legacyEvent,
+		},
+		{name: "protobuf", contentType: mq.ContentTypeProtobuf, body: body, want: event},
+		{name: "protobuf 带参数", contentType: mq.ContentTypeProtobuf + "; proto=order.OrderCreatedEvent", body: body, want: event},
+		{name: "protobuf 带未知字段", contentType: mq.ContentTypeProtobuf, body: future, want: event},
+		{name: "protobuf 缺少 content-type 按 JSON 解码失败", contentType: "", body: body, wantErr: true},
+		{name: "JSON 声明为 protobuf", contentType: mq.ContentTypeProtobuf, body: legacyJSON, wantErr: true},
+		{name: "JSON 缺少订单号", contentType: mq.ContentTypeJSON, body: []byte(`{"user_id":7}`), wantErr: true},
+		{name: "protobuf 缺少订单号", contentType: mq.ContentTypeProtobuf, body: nil, wantErr: true},
+		{name: "不支持的类型", contentType: "text/plain", body: legacyJSON, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mq.DecodeOrderEvent(tt.contentType, tt.body)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("期望解码失败，得到 %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("解码失败: %v", err)
+			}
+			// 比较已知字段，未知字段只要求不影响解码
+			got.ProtoReflect().SetUnknown(nil)
+			if !proto.Equal(got, tt.want) {
+				t.Fatalf("解码结果不符:\n得到 %v\n期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderEventMessageRoundTrip(t *testing.T) {
+	event := mq.NewOrderEvent("o2", 8, 43, 3, 12.25)
+	msg, err := broker.OrderEventMessage(event)
+	if err != nil {
+		t.Fatalf("构造消息失败: %v", err)
+	}
+	if msg.ID != event.OrderId || msg.Type != mq.OrderEventType {
+		t.Fatalf("消息属性不符: id=%s type=%s", msg.ID, msg.Type)
+	}
+
+	got, err := mq.DecodeOrderEvent(msg.ContentType, msg.Body)
+	if err != nil {
+		t.Fatalf("解码失败: %v", err)
+	}
+	if !proto.Equal(got, event) {
+		t.Fatalf("往返结果不符:\n得到 %v\n期望 %v", got, event)
+	}
+}
@@ -0,0 +1,51 @@
+package mq
+
+import (
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"seckill-mall/common/config"
+)
+
+// 默认重试延迟，配置文件未指定时使用
+var defaultRetryDelays = []time.Duration{time.Second, 5 * time.Second, 30 * time.Second}
+
+// RetryDelays 消费失败后逐次重试的延迟，对应的延迟队列随订单拓扑一并声明
+func RetryDelays() []time.Duration {
+	if len(config.Conf.MQ.RetryDelays) > 0 {
+		return config.Conf.MQ.RetryDelays
+	}
+	return defaultRetryDelays
+}
+
+// 消息头
+const (
+	RetryCountHeader = "x-retry-count" // 消息已重试次数
+	// 之前已投递的次数：quorum 队列由 RabbitMQ 维护，Redis/内存实现重新投递时累加
+	DeliveryCountHeader = "x-delivery-count"
+	// 消费者自行重新入队的次数(经典队列的崩溃重投、panic 隔离)，与 DeliveryCountHeader 相加即总投递次数
+	RequeueCountHeader  = "x-requeue-count"
+	FailureReasonHeader = "x-failure-reason" // 最近一次处理失败的原因
+	FailureStackHeader  = "x-failure-stack"  // 最近一次 panic 的堆栈
+	ParkedAtHeader      = "x-parked-at"      // 进入隔离队列的时间
+	OriginalQueueHeader = "x-original-queue" // 进入隔离队列前所在的队列
+)
+
+// RetryQueueName 延迟队列名，按目标队列与延迟时长区分，修改延迟会声明新队列而不是与旧队列参数冲突
+func RetryQueueName(queue string, delay time.Duration) string {
+	return queue + ".retry." + delay.String()
+}
+
+// DeclareDelayQueue 声明延迟队列：消息在队列中过期后经默认交换机回到目标队列
+// 延迟队列没有消费者，只靠 TTL 实现延迟
+func DeclareDelayQueue(ch *amqp.Channel, queue string, delay time.Duration) (string, error) {
+	name := RetryQueueName(queue, delay)
+	args := amqp.Table{
+		"x-message-ttl":             delay.Milliseconds(),
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": queue,
+	}
+	_, err := ch.QueueDeclare(name, true, false, false, false, args)
+	return name, err
+}
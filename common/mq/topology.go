@@ -0,0 +1,95 @@
+package mq
+
+import (
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"seckill-mall/common/config"
+)
+
+const (
+	OrderQueue = "seckill_order_queue"
+
+	DeadExchange   = "dlx_exchange" // 死信交换机
+	DeadQueue      = "dead_queue"   // 死信队列
+	DeadRoutingKey = "dead_key"     // 死信路由键
+
+	// 与死信队列绑定同一路由键，死信同时投递两份：dead_queue 留档供排查，这里的一份用于自动补偿
+	CompensationQueue = "dead_compensation_queue"
+
+	// 隔离队列：超过投递次数上限或格式错误的毒消息，不自动补偿，等待人工排查后重放或删除
+	ParkingQueue = "seckill_order_parking"
+)
+
+// 订单队列类型
+const (
+	QueueClassic = "classic"
+	QueueQuorum  = "quorum" // 由 RabbitMQ 统计投递次数(x-delivery-count)，超过 x-delivery-limit 进入死信
+)
+
+// DefaultDeliveryLimit 默认投递次数上限
+const DefaultDeliveryLimit = 5
+
+// IsQuorum 订单队列是否配置为 quorum 队列
+func IsQuorum() bool {
+	return config.Conf.MQ.QueueType == QueueQuorum
+}
+
+// DeliveryLimit 同一消息最多投递次数，超过后由消费者移入隔离队列
+func DeliveryLimit() int {
+	if config.Conf.MQ.DeliveryLimit > 0 {
+		return config.Conf.MQ.DeliveryLimit
+	}
+	return DefaultDeliveryLimit
+}
+
+// DeclareOrderTopology 声明订单队列及其死信队列，重复声明是幂等的，重连后可直接再调一次
+// 队列类型读取 mq.queue_type，所有声明该拓扑的进程需配置一致；已存在的经典队列需删除后才能改为 quorum
+func DeclareOrderTopology(ch *amqp.Channel) error {
+	//声明死信交换机
+	if err := ch.ExchangeDeclare(DeadExchange, "direct", true, false, false, false, nil); err != nil {
+		return err
+	}
+
+	//声明死信队列
+	if _, err := ch.QueueDeclare(DeadQueue, true, false, false, false, nil); err != nil {
+		return err
+	}
+
+	//绑定：死信交换机 -> 死信队列
+	if err := ch.QueueBind(DeadQueue, DeadRoutingKey, DeadExchange, false, nil); err != nil {
+		return err
+	}
+
+	if _, err := ch.QueueDeclare(CompensationQueue, true, false, false, false, nil); err != nil {
+		return err
+	}
+	if err := ch.QueueBind(CompensationQueue, DeadRoutingKey, DeadExchange, false, nil); err != nil {
+		return err
+	}
+
+	if _, err := ch.QueueDeclare(ParkingQueue, true, false, false, false, nil); err != nil {
+		return err
+	}
+
+	//声明主队列（业务队列），并配置它“连接”到死信交换机
+	args := amqp.Table{
+		"x-dead-letter-exchange":    DeadExchange,   // 报错后发给谁？
+		"x-dead-letter-routing-key": DeadRoutingKey, // 带什么暗号发？
+	}
+	if IsQuorum() {
+		args["x-queue-type"] = QueueQuorum
+		// 比消费者的上限多留一次，正常情况下由消费者带着失败原因移入隔离队列，Broker 的上限只做兜底
+		args["x-delivery-limit"] = DeliveryLimit() + 1
+	}
+	if _, err := ch.QueueDeclare(OrderQueue, true, false, false, false, args); err != nil {
+		return err
+	}
+
+	// 重试用的延迟队列随拓扑声明一次，发布延迟消息时不必再声明
+	for _, delay := range RetryDelays() {
+		if _, err := DeclareDelayQueue(ch, OrderQueue, delay); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package notification
+
+import "strconv"
+
+// 用户通知列表(最新的在前)，订单服务与消费者都会写入
+const (
+	KeyPrefix = "user:notifications:"
+	MaxItems  = 50 // 每个用户只保留最近的通知
+)
+
+func Key(userID int64) string {
+	return KeyPrefix + strconv.FormatInt(userID, 10)
+}
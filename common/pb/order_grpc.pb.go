@@ -20,7 +20,12 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	OrderService_CreateOrder_FullMethodName = "/order.OrderService/CreateOrder"
+	OrderService_CreateOrder_FullMethodName           = "/order.OrderService/CreateOrder"
+	OrderService_GetNotifications_FullMethodName      = "/order.OrderService/GetNotifications"
+	OrderService_RegisterRaffle_FullMethodName        = "/order.OrderService/RegisterRaffle"
+	OrderService_GetRaffle_FullMethodName             = "/order.OrderService/GetRaffle"
+	OrderService_GetRaffleParticipants_FullMethodName = "/order.OrderService/GetRaffleParticipants"
+	OrderService_GetOrderStatus_FullMethodName        = "/order.OrderService/GetOrderStatus"
 )
 
 // OrderServiceClient is the client API for OrderService service.
@@ -30,6 +35,14 @@ const (
 // 定义服务
 type OrderServiceClient interface {
 	CreateOrder(ctx context.Context, in *CreateOrderRequest, opts ...grpc.CallOption) (*CreateOrderResponse, error)
+	// 查询用户通知
+	GetNotifications(ctx context.Context, in *NotificationRequest, opts ...grpc.CallOption) (*NotificationResponse, error)
+	// 抽签发售：登记与查询结果
+	RegisterRaffle(ctx context.Context, in *RaffleRequest, opts ...grpc.CallOption) (*RaffleResponse, error)
+	GetRaffle(ctx context.Context, in *RaffleRequest, opts ...grpc.CallOption) (*RaffleResponse, error)
+	GetRaffleParticipants(ctx context.Context, in *RaffleRequest, opts ...grpc.CallOption) (*RaffleParticipantsResponse, error)
+	// 查询订单状态
+	GetOrderStatus(ctx context.Context, in *OrderStatusRequest, opts ...grpc.CallOption) (*OrderStatusResponse, error)
 }
 
 type orderServiceClient struct {
@@ -50,6 +63,56 @@ func (c *orderServiceClient) CreateOrder(ctx context.Context, in *CreateOrderReq
 	return out, nil
 }
 
+func (c *orderServiceClient) GetNotifications(ctx context.Context, in *NotificationRequest, opts ...grpc.CallOption) (*NotificationResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(NotificationResponse)
+	err := c.cc.Invoke(ctx, OrderService_GetNotifications_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orderServiceClient) RegisterRaffle(ctx context.Context, in *RaffleRequest, opts ...grpc.CallOption) (*RaffleResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RaffleResponse)
+	err := c.cc.Invoke(ctx, OrderService_RegisterRaffle_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orderServiceClient) GetRaffle(ctx context.Context, in *RaffleRequest, opts ...grpc.CallOption) (*RaffleResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RaffleResponse)
+	err := c.cc.Invoke(ctx, OrderService_GetRaffle_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orderServiceClient) GetRaffleParticipants(ctx context.Context, in *RaffleRequest, opts ...grpc.CallOption) (*RaffleParticipantsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RaffleParticipantsResponse)
+	err := c.cc.Invoke(ctx, OrderService_GetRaffleParticipants_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orderServiceClient) GetOrderStatus(ctx context.Context, in *OrderStatusRequest, opts ...grpc.CallOption) (*OrderStatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(OrderStatusResponse)
+	err := c.cc.Invoke(ctx, OrderService_GetOrderStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // OrderServiceServer is the server API for OrderService service.
 // All implementations must embed UnimplementedOrderServiceServer
 // for forward compatibility.
@@ -57,6 +120,14 @@ func (c *orderServiceClient) CreateOrder(ctx context.Context, in *CreateOrderReq
 // 定义服务
 type OrderServiceServer interface {
 	CreateOrder(context.Context, *CreateOrderRequest) (*CreateOrderResponse, error)
+	// 查询用户通知
+	GetNotifications(context.Context, *NotificationRequest) (*NotificationResponse, error)
+	// 抽签发售：登记与查询结果
+	RegisterRaffle(context.Context, *RaffleRequest) (*RaffleResponse, error)
+	GetRaffle(context.Context, *RaffleRequest) (*RaffleResponse, error)
+	GetRaffleParticipants(context.Context, *RaffleRequest) (*RaffleParticipantsResponse, error)
+	// 查询订单状态
+	GetOrderStatus(context.Context, *OrderStatusRequest) (*OrderStatusResponse, error)
 	mustEmbedUnimplementedOrderServiceServer()
 }
 
@@ -70,6 +141,21 @@ type UnimplementedOrderServiceServer struct{}
 func (UnimplementedOrderServiceServer) CreateOrder(context.Context, *CreateOrderRequest) (*CreateOrderResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method CreateOrder not implemented")
 }
+func (UnimplementedOrderServiceServer) GetNotifications(context.Context, *NotificationRequest) (*NotificationResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetNotifications not implemented")
+}
+func (UnimplementedOrderServiceServer) RegisterRaffle(context.Context, *RaffleRequest) (*RaffleResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method RegisterRaffle not implemented")
+}
+func (UnimplementedOrderServiceServer) GetRaffle(context.Context, *RaffleRequest) (*RaffleResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetRaffle not implemented")
+}
+func (UnimplementedOrderServiceServer) GetRaffleParticipants(context.Context, *RaffleRequest) (*RaffleParticipantsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetRaffleParticipants not implemented")
+}
+func (UnimplementedOrderServiceServer) GetOrderStatus(context.Context, *OrderStatusRequest) (*OrderStatusResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetOrderStatus not implemented")
+}
 func (UnimplementedOrderServiceServer) mustEmbedUnimplementedOrderServiceServer() {}
 func (UnimplementedOrderServiceServer) testEmbeddedByValue()                      {}
 
@@ -109,6 +195,96 @@ func _OrderService_CreateOrder_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _OrderService_GetNotifications_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NotificationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrderServiceServer).GetNotifications(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrderService_GetNotifications_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrderServiceServer).GetNotifications(ctx, req.(*NotificationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrderService_RegisterRaffle_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RaffleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrderServiceServer).RegisterRaffle(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrderService_RegisterRaffle_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrderServiceServer).RegisterRaffle(ctx, req.(*RaffleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrderService_GetRaffle_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RaffleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrderServiceServer).GetRaffle(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrderService_GetRaffle_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrderServiceServer).GetRaffle(ctx, req.(*RaffleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrderService_GetRaffleParticipants_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RaffleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrderServiceServer).GetRaffleParticipants(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrderService_GetRaffleParticipants_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrderServiceServer).GetRaffleParticipants(ctx, req.(*RaffleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrderService_GetOrderStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OrderStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrderServiceServer).GetOrderStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrderService_GetOrderStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrderServiceServer).GetOrderStatus(ctx, req.(*OrderStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // OrderService_ServiceDesc is the grpc.ServiceDesc for OrderService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -120,6 +296,26 @@ var OrderService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "CreateOrder",
 			Handler:    _OrderService_CreateOrder_Handler,
 		},
+		{
+			MethodName: "GetNotifications",
+			Handler:    _OrderService_GetNotifications_Handler,
+		},
+		{
+			MethodName: "RegisterRaffle",
+			Handler:    _OrderService_RegisterRaffle_Handler,
+		},
+		{
+			MethodName: "GetRaffle",
+			Handler:    _OrderService_GetRaffle_Handler,
+		},
+		{
+			MethodName: "GetRaffleParticipants",
+			Handler:    _OrderService_GetRaffleParticipants_Handler,
+		},
+		{
+			MethodName: "GetOrderStatus",
+			Handler:    _OrderService_GetOrderStatus_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/order.proto",
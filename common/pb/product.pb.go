@@ -130,8 +130,10 @@ func (x *ProductResponse) GetPrice() float32 {
 type DeductStockRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	ProductId     int64                  `protobuf:"varint,1,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
-	Count         int32                  `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`                 // 扣几个
-	UserId        int64                  `protobuf:"varint,3,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"` // 谁在扣库存
+	Count         int32                  `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`                   // 扣几个
+	UserId        int64                  `protobuf:"varint,3,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`   // 谁在扣库存
+	OrderId       string                 `protobuf:"bytes,4,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"` // 关联订单号，写入库存流水
+	Reason        string                 `protobuf:"bytes,5,opt,name=reason,proto3" json:"reason,omitempty"`                  // 变更原因，留空时按接口默认(deduct/rollback)
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -187,6 +189,20 @@ func (x *DeductStockRequest) GetUserId() int64 {
 	return 0
 }
 
+func (x *DeductStockRequest) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+func (x *DeductStockRequest) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
 type DeductStockResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
@@ -239,6 +255,127 @@ func (x *DeductStockResponse) GetMessage() string {
 	return ""
 }
 
+// 候补排队请求
+type WaitlistRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ProductId     int64                  `protobuf:"varint,1,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	UserId        int64                  `protobuf:"varint,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Count         int32                  `protobuf:"varint,3,opt,name=count,proto3" json:"count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WaitlistRequest) Reset() {
+	*x = WaitlistRequest{}
+	mi := &file_proto_product_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WaitlistRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WaitlistRequest) ProtoMessage() {}
+
+func (x *WaitlistRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_product_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WaitlistRequest.ProtoReflect.Descriptor instead.
+func (*WaitlistRequest) Descriptor() ([]byte, []int) {
+	return file_proto_product_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *WaitlistRequest) GetProductId() int64 {
+	if x != nil {
+		return x.ProductId
+	}
+	return 0
+}
+
+func (x *WaitlistRequest) GetUserId() int64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+func (x *WaitlistRequest) GetCount() int32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+type WaitlistResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Position      int64                  `protobuf:"varint,3,opt,name=position,proto3" json:"position,omitempty"` // 当前排在第几位
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WaitlistResponse) Reset() {
+	*x = WaitlistResponse{}
+	mi := &file_proto_product_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WaitlistResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WaitlistResponse) ProtoMessage() {}
+
+func (x *WaitlistResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_product_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WaitlistResponse.ProtoReflect.Descriptor instead.
+func (*WaitlistResponse) Descriptor() ([]byte, []int) {
+	return file_proto_product_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *WaitlistResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *WaitlistResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *WaitlistResponse) GetPosition() int64 {
+	if x != nil {
+		return x.Position
+	}
+	return 0
+}
+
 var File_proto_product_proto protoreflect.FileDescriptor
 
 const file_proto_product_proto_rawDesc = "" +
@@ -251,20 +388,32 @@ const file_proto_product_proto_rawDesc = "" +
 	"\n" +
 	"product_id\x18\x01 \x01(\x03R\tproductId\x12\x12\n" +
 	"\x04name\x18\x02 \x01(\tR\x04name\x12\x14\n" +
-	"\x05price\x18\x03 \x01(\x02R\x05price\"b\n" +
+	"\x05price\x18\x03 \x01(\x02R\x05price\"\x95\x01\n" +
 	"\x12DeductStockRequest\x12\x1d\n" +
 	"\n" +
 	"product_id\x18\x01 \x01(\x03R\tproductId\x12\x14\n" +
 	"\x05count\x18\x02 \x01(\x05R\x05count\x12\x17\n" +
-	"\auser_id\x18\x03 \x01(\x03R\x06userId\"I\n" +
+	"\auser_id\x18\x03 \x01(\x03R\x06userId\x12\x19\n" +
+	"\border_id\x18\x04 \x01(\tR\aorderId\x12\x16\n" +
+	"\x06reason\x18\x05 \x01(\tR\x06reason\"I\n" +
 	"\x13DeductStockResponse\x12\x18\n" +
 	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
-	"\amessage\x18\x02 \x01(\tR\amessage2\xe7\x01\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"_\n" +
+	"\x0fWaitlistRequest\x12\x1d\n" +
+	"\n" +
+	"product_id\x18\x01 \x01(\x03R\tproductId\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\x03R\x06userId\x12\x14\n" +
+	"\x05count\x18\x03 \x01(\x05R\x05count\"b\n" +
+	"\x10WaitlistResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12\x1a\n" +
+	"\bposition\x18\x03 \x01(\x03R\bposition2\xac\x02\n" +
 	"\x0eProductService\x12?\n" +
 	"\n" +
 	"GetProduct\x12\x17.product.ProductRequest\x1a\x18.product.ProductResponse\x12H\n" +
 	"\vDeductStock\x12\x1b.product.DeductStockRequest\x1a\x1c.product.DeductStockResponse\x12J\n" +
-	"\rRollbackStock\x12\x1b.product.DeductStockRequest\x1a\x1c.product.DeductStockResponseB\x10Z\x0e./common/pb;pbb\x06proto3"
+	"\rRollbackStock\x12\x1b.product.DeductStockRequest\x1a\x1c.product.DeductStockResponse\x12C\n" +
+	"\fJoinWaitlist\x12\x18.product.WaitlistRequest\x1a\x19.product.WaitlistResponseB\x10Z\x0e./common/pb;pbb\x06proto3"
 
 var (
 	file_proto_product_proto_rawDescOnce sync.Once
@@ -278,22 +427,26 @@ func file_proto_product_proto_rawDescGZIP() []byte {
 	return file_proto_product_proto_rawDescData
 }
 
-var file_proto_product_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_proto_product_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
 var file_proto_product_proto_goTypes = []any{
 	(*ProductRequest)(nil),      // 0: product.ProductRequest
 	(*ProductResponse)(nil),     // 1: product.ProductResponse
 	(*DeductStockRequest)(nil),  // 2: product.DeductStockRequest
 	(*DeductStockResponse)(nil), // 3: product.DeductStockResponse
+	(*WaitlistRequest)(nil),     // 4: product.WaitlistRequest
+	(*WaitlistResponse)(nil),    // 5: product.WaitlistResponse
 }
 var file_proto_product_proto_depIdxs = []int32{
 	0, // 0: product.ProductService.GetProduct:input_type -> product.ProductRequest
 	2, // 1: product.ProductService.DeductStock:input_type -> product.DeductStockRequest
 	2, // 2: product.ProductService.RollbackStock:input_type -> product.DeductStockRequest
-	1, // 3: product.ProductService.GetProduct:output_type -> product.ProductResponse
-	3, // 4: product.ProductService.DeductStock:output_type -> product.DeductStockResponse
-	3, // 5: product.ProductService.RollbackStock:output_type -> product.DeductStockResponse
-	3, // [3:6] is the sub-list for method output_type
-	0, // [0:3] is the sub-list for method input_type
+	4, // 3: product.ProductService.JoinWaitlist:input_type -> product.WaitlistRequest
+	1, // 4: product.ProductService.GetProduct:output_type -> product.ProductResponse
+	3, // 5: product.ProductService.DeductStock:output_type -> product.DeductStockResponse
+	3, // 6: product.ProductService.RollbackStock:output_type -> product.DeductStockResponse
+	5, // 7: product.ProductService.JoinWaitlist:output_type -> product.WaitlistResponse
+	4, // [4:8] is the sub-list for method output_type
+	0, // [0:4] is the sub-list for method input_type
 	0, // [0:0] is the sub-list for extension type_name
 	0, // [0:0] is the sub-list for extension extendee
 	0, // [0:0] is the sub-list for field type_name
@@ -310,7 +463,7 @@ func file_proto_product_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_product_proto_rawDesc), len(file_proto_product_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   4,
+			NumMessages:   6,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -23,6 +23,7 @@ const (
 	ProductService_GetProduct_FullMethodName    = "/product.ProductService/GetProduct"
 	ProductService_DeductStock_FullMethodName   = "/product.ProductService/DeductStock"
 	ProductService_RollbackStock_FullMethodName = "/product.ProductService/RollbackStock"
+	ProductService_JoinWaitlist_FullMethodName  = "/product.ProductService/JoinWaitlist"
 )
 
 // ProductServiceClient is the client API for ProductService service.
@@ -33,6 +34,8 @@ type ProductServiceClient interface {
 	DeductStock(ctx context.Context, in *DeductStockRequest, opts ...grpc.CallOption) (*DeductStockResponse, error)
 	// 回滚库存接口
 	RollbackStock(ctx context.Context, in *DeductStockRequest, opts ...grpc.CallOption) (*DeductStockResponse, error)
+	// 售罄后加入候补队列
+	JoinWaitlist(ctx context.Context, in *WaitlistRequest, opts ...grpc.CallOption) (*WaitlistResponse, error)
 }
 
 type productServiceClient struct {
@@ -73,6 +76,16 @@ func (c *productServiceClient) RollbackStock(ctx context.Context, in *DeductStoc
 	return out, nil
 }
 
+func (c *productServiceClient) JoinWaitlist(ctx context.Context, in *WaitlistRequest, opts ...grpc.CallOption) (*WaitlistResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WaitlistResponse)
+	err := c.cc.Invoke(ctx, ProductService_JoinWaitlist_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ProductServiceServer is the server API for ProductService service.
 // All implementations must embed UnimplementedProductServiceServer
 // for forward compatibility.
@@ -81,6 +94,8 @@ type ProductServiceServer interface {
 	DeductStock(context.Context, *DeductStockRequest) (*DeductStockResponse, error)
 	// 回滚库存接口
 	RollbackStock(context.Context, *DeductStockRequest) (*DeductStockResponse, error)
+	// 售罄后加入候补队列
+	JoinWaitlist(context.Context, *WaitlistRequest) (*WaitlistResponse, error)
 	mustEmbedUnimplementedProductServiceServer()
 }
 
@@ -100,6 +115,9 @@ func (UnimplementedProductServiceServer) DeductStock(context.Context, *DeductSto
 func (UnimplementedProductServiceServer) RollbackStock(context.Context, *DeductStockRequest) (*DeductStockResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method RollbackStock not implemented")
 }
+func (UnimplementedProductServiceServer) JoinWaitlist(context.Context, *WaitlistRequest) (*WaitlistResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method JoinWaitlist not implemented")
+}
 func (UnimplementedProductServiceServer) mustEmbedUnimplementedProductServiceServer() {}
 func (UnimplementedProductServiceServer) testEmbeddedByValue()                        {}
 
@@ -175,6 +193,24 @@ func _ProductService_RollbackStock_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ProductService_JoinWaitlist_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WaitlistRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProductServiceServer).JoinWaitlist(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProductService_JoinWaitlist_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProductServiceServer).JoinWaitlist(ctx, req.(*WaitlistRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // ProductService_ServiceDesc is the grpc.ServiceDesc for ProductService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -194,6 +230,10 @@ var ProductService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "RollbackStock",
 			Handler:    _ProductService_RollbackStock_Handler,
 		},
+		{
+			MethodName: "JoinWaitlist",
+			Handler:    _ProductService_JoinWaitlist_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/product.proto",
@@ -0,0 +1,66 @@
+package raffle
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	mrand "math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// 抽签算法：
+//  1. 报名用户按 UserID 升序排列，保证输入与报名先后无关
+//  2. 以 SHA-256(seed) 作为 ChaCha8 的种子，做 Fisher-Yates 洗牌
+//  3. 取洗牌后的前 n 个作为中签者
+//
+// 登记期间只公开 Commitment(seed)，开奖后公开 seed，任何人都可以用同样的参与名单复现结果
+
+// NewSeed 生成随机种子(十六进制)
+func NewSeed() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Commitment 种子承诺值，开奖前公开，防止事后替换种子
+func Commitment(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParticipantsDigest 参与名单摘要，用于核对复现时使用的名单与开奖时一致
+func ParticipantsDigest(participants []int64) string {
+	sorted := sortedCopy(participants)
+	ids := make([]string, len(sorted))
+	for i, id := range sorted {
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(ids, ",")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Draw 从参与者中抽取 n 个中签者，结果按中签顺序排列
+func Draw(seed string, participants []int64, n int) []int64 {
+	users := sortedCopy(participants)
+	if n > len(users) {
+		n = len(users)
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	rng := mrand.New(mrand.NewChaCha8(sha256.Sum256([]byte(seed))))
+	for i := 0; i < n; i++ {
+		j := i + rng.IntN(len(users)-i)
+		users[i], users[j] = users[j], users[i]
+	}
+	return users[:n]
+}
+
+func sortedCopy(ids []int64) []int64 {
+	out := slices.Clone(ids)
+	slices.Sort(out)
+	return out
+}
@@ -0,0 +1,78 @@
+package raffle
+
+import (
+	"slices"
+	"testing"
+)
+
+// 以下期望值是已公开开奖结果的复现依据：修改抽签算法或升级 Go 后 ChaCha8、IntN 的输出一旦变化，
+// 历史开奖就无法再复现，这里的测试会先失败
+const testSeed = "seckill-raffle-seed"
+
+var testParticipants = []int64{1001, 1002, 1003, 1004, 1005, 1006, 1007, 1008, 1009, 1010, 1011, 1012}
+
+func TestDrawPinned(t *testing.T) {
+	want := []int64{1002, 1007, 1012, 1008, 1003}
+	if got := Draw(testSeed, testParticipants, 5); !slices.Equal(got, want) {
+		t.Fatalf("固定种子与名单的开奖结果变化: 得到 %v，期望 %v", got, want)
+	}
+}
+
+func TestDrawIndependentOfInputOrder(t *testing.T) {
+	want := Draw(testSeed, testParticipants, 5)
+
+	reversed := slices.Clone(testParticipants)
+	slices.Reverse(reversed)
+	shuffled := []int64{1007, 1003, 1012, 1001, 1010, 1005, 1008, 1002, 1011, 1004, 1009, 1006}
+	for _, input := range [][]int64{reversed, shuffled} {
+		if got := Draw(testSeed, input, 5); !slices.Equal(got, want) {
+			t.Fatalf("开奖结果不应依赖名单顺序: 输入 %v 得到 %v，期望 %v", input, got, want)
+		}
+	}
+	// 不修改调用方的名单
+	if !slices.Equal(shuffled, []int64{1007, 1003, 1012, 1001, 1010, 1005, 1008, 1002, 1011, 1004, 1009, 1006}) {
+		t.Fatalf("Draw 修改了传入的名单: %v", shuffled)
+	}
+}
+
+func TestDrawBounds(t *testing.T) {
+	if got := Draw(testSeed, testParticipants, 0); got != nil {
+		t.Fatalf("中签数为 0 时应无人中签，得到 %v", got)
+	}
+	all := Draw(testSeed, testParticipants, len(testParticipants)+3)
+	if len(all) != len(testParticipants) {
+		t.Fatalf("名额多于报名人数时所有人中签，得到 %v", all)
+	}
+	// 前 n 个中签者与只抽 n 个的结果一致
+	if !slices.Equal(all[:5], Draw(testSeed, testParticipants, 5)) {
+		t.Fatalf("中签顺序应与名额无关: %v", all)
+	}
+	sorted := slices.Clone(all)
+	slices.Sort(sorted)
+	if !slices.Equal(sorted, testParticipants) {
+		t.Fatalf("中签者应是不重复的报名用户: %v", all)
+	}
+}
+
+func TestDigestAndCommitmentPinned(t *testing.T) {
+	// SHA-256("1001,1002,...,1012")
+	const digest = "ce6ee1d6d55f278d514ce48c71232db9557484954f84f4cd245fa1b35feb0c97"
+	if got := ParticipantsDigest(testParticipants); got != digest {
+		t.Fatalf("名单摘要变化: 得到 %s，期望 %s", got, digest)
+	}
+	reversed := slices.Clone(testParticipants)
+	slices.Reverse(reversed)
+	if got := ParticipantsDigest(reversed); got != digest {
+		t.Fatalf("名单摘要不应依赖名单顺序: 得到 %s", got)
+	}
+	// 空名单即 SHA-256("")
+	if got := ParticipantsDigest(nil); got != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Fatalf("空名单摘要变化: %s", got)
+	}
+
+	// SHA-256(seed)
+	const commitment = "c60c5f91205a5fdf9b26008ecdfe4ba092cb67ee055aeaccb527b957ff903876"
+	if got := Commitment(testSeed); got != commitment {
+		t.Fatalf("种子承诺值变化: 得到 %s，期望 %s", got, commitment)
+	}
+}
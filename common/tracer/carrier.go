@@ -0,0 +1,62 @@
+package tracer
+
+import (
+	"context"
+	"encoding/json"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// HeaderCarrier 把消息头(amqp.Table 或 broker.Message.Headers)适配为 TextMapCarrier
+type HeaderCarrier map[string]interface{}
+
+func (c HeaderCarrier) Get(key string) string {
+	v, _ := c[key].(string)
+	return v
+}
+
+func (c HeaderCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// InjectHeaders 把 ctx 中的链路上下文(W3C traceparent/tracestate、baggage)写入消息头
+func InjectHeaders(ctx context.Context, headers map[string]interface{}) {
+	otel.GetTextMapPropagator().Inject(ctx, HeaderCarrier(headers))
+}
+
+// ExtractHeaders 从消息头恢复上游的链路上下文
+func ExtractHeaders(ctx context.Context, headers map[string]interface{}) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, HeaderCarrier(headers))
+}
+
+// Marshal 把链路上下文序列化为 JSON，用于随数据落库(如发件箱)后再恢复
+func Marshal(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(carrier)
+	return string(b)
+}
+
+// Unmarshal 恢复 Marshal 保存的链路上下文，内容为空或格式错误时返回原 ctx
+func Unmarshal(ctx context.Context, s string) context.Context {
+	if s == "" {
+		return ctx
+	}
+	carrier := propagation.MapCarrier{}
+	if err := json.Unmarshal([]byte(s), &carrier); err != nil {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
@@ -1,46 +1,105 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// 定义加密密钥，后期配置在config.yaml中
-var jwtSecret = []byte("seckill-secert-key-2025")
+// Token 类型：访问令牌短期有效，刷新令牌只能用于换取新的令牌对
+const (
+	TokenAccess  = "access"
+	TokenRefresh = "refresh"
+)
+
+var ErrTokenType = errors.New("token type mismatch")
+
+// MockUserIDBase 模拟登录签发的用户ID从该值起算，真实用户(users 表自增ID)不会到达这个区间
+const MockUserIDBase int64 = 1_000_000_000_000
 
 // 自定义Claims结构体
 type UserClaims struct {
-	UserID int64 `json:"user_id"`
+	UserID int64  `json:"user_id"`
+	Type   string `json:"typ"`
+	Family string `json:"fid"` //同一次登录轮换出的所有令牌共享一个家族 ID，用于整体吊销
 	jwt.RegisteredClaims
 }
 
-// 生成Token
-func GenerateToken(userID int64, expireDuration time.Duration) (string, error) {
-	now := time.Now()
-	expireTime := now.Add(expireDuration)
+// TokenPair 登录/刷新时签发的令牌对
+type TokenPair struct {
+	AccessToken   string
+	RefreshToken  string
+	AccessClaims  *UserClaims
+	RefreshClaims *UserClaims
+}
 
-	claims := UserClaims{
+// NewTokenID 生成随机 ID，用作 jti 与家族 ID
+func NewTokenID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func newClaims(userID int64, typ, family string, expireDuration time.Duration) *UserClaims {
+	now := time.Now()
+	return &UserClaims{
 		UserID: userID,
+		Type:   typ,
+		Family: family,
 		RegisteredClaims: jwt.RegisteredClaims{
-			//NotBefore: jwt.NewNumericDate(now), // 可选：生效时间
-			//IssuedAt:  jwt.NewNumericDate(now), // 可选：签发时间
-			ExpiresAt: jwt.NewNumericDate(expireTime),
-			Issuer:    "seckill-app",
+			ID:        NewTokenID(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expireDuration)),
+			Issuer:    issuer,
+			Audience:  jwt.ClaimStrings{audience},
 		},
 	}
+}
+
+// sign 使用当前密钥签名，并在头部写入 kid 以便密钥轮换后仍能找到验签密钥
+func sign(claims *UserClaims) (string, error) {
+	if activeKey == nil {
+		return "", errors.New("jwt keys not initialized")
+	}
+	tokenClaims := jwt.NewWithClaims(activeKey.method, claims)
+	tokenClaims.Header["kid"] = activeKey.kid
+	return tokenClaims.SignedString(activeKey.sign)
+}
 
-	tokenClaims := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return tokenClaims.SignedString(jwtSecret)
+// GenerateTokenPair 签发同一家族的访问令牌与刷新令牌
+func GenerateTokenPair(userID int64, family string, accessExpire, refreshExpire time.Duration) (*TokenPair, error) {
+	access := newClaims(userID, TokenAccess, family, accessExpire)
+	refresh := newClaims(userID, TokenRefresh, family, refreshExpire)
+
+	accessToken, err := sign(access)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := sign(refresh)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:   accessToken,
+		RefreshToken:  refreshToken,
+		AccessClaims:  access,
+		RefreshClaims: refresh,
+	}, nil
 }
 
 // 解析Token
 func ParseToken(token string) (*UserClaims, error) {
-	//解析并验证签名
-	tokenClaims, err := jwt.ParseWithClaims(token, &UserClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+	//按 kid 选择密钥验证签名，并校验签发方与受众
+	tokenClaims, err := jwt.ParseWithClaims(token, &UserClaims{}, keyFunc,
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+	)
 
 	if err != nil {
 		return nil, err
@@ -52,3 +111,15 @@ func ParseToken(token string) (*UserClaims, error) {
 
 	return nil, errors.New("invalid token")
 }
+
+// ParseTokenOf 解析并校验 Token 类型，防止刷新令牌被当作访问令牌使用
+func ParseTokenOf(token, typ string) (*UserClaims, error) {
+	claims, err := ParseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != typ {
+		return nil, ErrTokenType
+	}
+	return claims, nil
+}
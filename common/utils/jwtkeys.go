@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"seckill-mall/common/config"
+)
+
+const (
+	DefaultIssuer   = "seckill-app"
+	DefaultAudience = "seckill-mall"
+	legacyKid       = "default" //只配置了 jwt.secret 时使用的密钥 ID
+	minSecretLen    = 32
+)
+
+// jwtKey 一把签名/验签密钥，非当前密钥只用于校验轮换前签发的 Token
+type jwtKey struct {
+	kid    string
+	method jwt.SigningMethod
+	sign   crypto.PrivateKey //HS256 为 []byte；仅验签的旧密钥为 nil
+	verify crypto.PublicKey  //HS256 为 []byte
+}
+
+var (
+	keys      = map[string]*jwtKey{}
+	activeKey *jwtKey
+	issuer    = DefaultIssuer
+	audience  = DefaultAudience
+)
+
+// InitJWT 按配置加载密钥
+// 未配置 jwt.keys 时兼容旧配置，把 jwt.secret 作为 HS256 密钥
+func InitJWT(conf config.JWTConfig) error {
+	loaded := map[string]*jwtKey{}
+	keyConfs := conf.Keys
+	activeKid := conf.ActiveKid
+	if len(keyConfs) == 0 {
+		if conf.Secret == "" {
+			return errors.New("未配置 JWT 密钥(jwt.keys 或 jwt.secret)")
+		}
+		keyConfs = []config.JWTKeyConfig{{Kid: legacyKid, Alg: jwt.SigningMethodHS256.Alg(), Secret: conf.Secret}}
+		activeKid = legacyKid
+	}
+
+	for _, kc := range keyConfs {
+		if kc.Kid == "" {
+			return errors.New("JWT 密钥缺少 kid")
+		}
+		if _, ok := loaded[kc.Kid]; ok {
+			return fmt.Errorf("JWT 密钥 kid 重复: %s", kc.Kid)
+		}
+		k, err := loadKey(kc)
+		if err != nil {
+			return fmt.Errorf("加载 JWT 密钥 %s 失败: %w", kc.Kid, err)
+		}
+		loaded[kc.Kid] = k
+	}
+
+	if activeKid == "" && len(keyConfs) == 1 {
+		activeKid = keyConfs[0].Kid
+	}
+	active, ok := loaded[activeKid]
+	if !ok {
+		return fmt.Errorf("jwt.active_kid %q 不在 jwt.keys 中", activeKid)
+	}
+	if active.sign == nil {
+		return fmt.Errorf("当前签名密钥 %s 缺少私钥", activeKid)
+	}
+
+	keys = loaded
+	activeKey = active
+	issuer, audience = DefaultIssuer, DefaultAudience
+	if conf.Issuer != "" {
+		issuer = conf.Issuer
+	}
+	if conf.Audience != "" {
+		audience = conf.Audience
+	}
+	log.Printf("JWT 密钥已加载: 签名 kid=%s alg=%s，共 %d 把可验签密钥", active.kid, active.method.Alg(), len(keys))
+	return nil
+}
+
+func loadKey(kc config.JWTKeyConfig) (*jwtKey, error) {
+	k := &jwtKey{kid: kc.Kid}
+	switch kc.Alg {
+	case "", jwt.SigningMethodHS256.Alg():
+		k.method = jwt.SigningMethodHS256
+		secret, err := readValue(kc.Secret, kc.SecretFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(secret) == 0 {
+			return nil, errors.New("HS256 密钥缺少 secret 或 secret_file")
+		}
+		if len(secret) < minSecretLen {
+			log.Printf("⚠️ JWT 密钥 %s 长度不足 %d 字节，建议更换为随机生成的长密钥", kc.Kid, minSecretLen)
+		}
+		k.sign, k.verify = secret, secret
+
+	case jwt.SigningMethodRS256.Alg():
+		k.method = jwt.SigningMethodRS256
+		if kc.PrivateKeyFile != "" {
+			pem, err := os.ReadFile(kc.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			priv, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			k.sign, k.verify = priv, &priv.PublicKey
+		} else if kc.PublicKeyFile != "" {
+			pem, err := os.ReadFile(kc.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			pub, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			k.verify = pub
+		}
+
+	case jwt.SigningMethodEdDSA.Alg():
+		k.method = jwt.SigningMethodEdDSA
+		if kc.PrivateKeyFile != "" {
+			pem, err := os.ReadFile(kc.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			priv, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			k.sign, k.verify = priv, priv.(ed25519.PrivateKey).Public()
+		} else if kc.PublicKeyFile != "" {
+			pem, err := os.ReadFile(kc.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			pub, err := jwt.ParseEdPublicKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			k.verify = pub
+		}
+
+	default:
+		return nil, fmt.Errorf("不支持的算法 %s(可选 HS256、RS256、EdDSA)", kc.Alg)
+	}
+
+	if k.verify == nil {
+		return nil, errors.New("缺少 private_key_file 或 public_key_file")
+	}
+	return k, nil
+}
+
+// readValue 优先读取文件，便于通过挂载的 Secret 注入密钥
+func readValue(value, file string) ([]byte, error) {
+	if file == "" {
+		return []byte(value), nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.TrimSpace(string(b))), nil
+}
+
+// keyFunc 按 Token 头部的 kid 选择验签密钥，并要求算法与密钥一致
+func keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	k, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for kid %s", token.Method.Alg(), kid)
+	}
+	return k.verify, nil
+}
+
+// JWK 公钥的 JSON Web Key 表示
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS 返回所有可验签的非对称公钥；HS256 密钥为共享密钥，不对外公开
+func JWKS() []JWK {
+	set := []JWK{}
+	for _, k := range keys {
+		switch pub := k.verify.(type) {
+		case *rsa.PublicKey:
+			set = append(set, JWK{
+				Kty: "RSA", Kid: k.kid, Use: "sig", Alg: k.method.Alg(),
+				N: base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set = append(set, JWK{
+				Kty: "OKP", Kid: k.kid, Use: "sig", Alg: k.method.Alg(),
+				Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return set
+}
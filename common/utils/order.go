@@ -0,0 +1,12 @@
+package utils
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// 生成订单号：纳秒时间戳 + 随机数
+func GenerateOrderID() string {
+	return fmt.Sprintf("%d%d", time.Now().UnixNano(), rand.Intn(1000))
+}
@@ -0,0 +1,20 @@
+package waitlist
+
+// 商品服务把回流库存分配给候补用户后，写入该队列，由订单服务代为下单
+const AllocationKey = "waitlist:allocations"
+
+// 订单服务取出的分配先移入各实例的处理中列表，写入发件箱后才删除；实例重启时放回 AllocationKey
+const ProcessingKeyPrefix = "waitlist:processing:"
+
+// ProcessingKey 实例的处理中列表，instance 需在重启前后保持不变
+func ProcessingKey(instance string) string {
+	return ProcessingKeyPrefix + instance
+}
+
+// Allocation 一次候补分配结果，JSON 由 Lua 脚本拼接
+type Allocation struct {
+	OrderID   string `json:"order_id"`
+	UserID    int64  `json:"user_id"`
+	ProductID int64  `json:"product_id"`
+	Count     int32  `json:"count"`
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/redis/go-redis/v9"
+
+	"seckill-mall/common/broker"
+	"seckill-mall/common/config"
+	"seckill-mall/common/ledger"
+	"seckill-mall/common/mq"
+	"seckill-mall/common/pb"
+)
+
+// 死信队列运维工具：查看 dead_queue(或隔离队列 seckill_order_parking)中的消息，按需重放回订单队列、清除或导出
+// 实现方式是逐条 basic.get 取出全部消息，处理完未选中的消息再放回原队列，
+// 因此运行期间队列中的消息对其他消费者不可见
+// 逐条取出与放回依赖 AMQP 的 basic.get，目前只支持 mq.backend=rabbitmq
+
+// 重放时去掉的消息头，重放的消息重新计算重试与投递次数
+var replayStripHeaders = map[string]bool{
+	"x-death":              true,
+	mq.RetryCountHeader:    true,
+	mq.DeliveryCountHeader: true,
+	mq.RequeueCountHeader:  true,
+	mq.FailureReasonHeader: true,
+	mq.FailureStackHeader:  true,
+	mq.ParkedAtHeader:      true,
+	mq.OriginalQueueHeader: true,
+}
+
+// deadLetter 导出到文件的死信记录
+type deadLetter struct {
+	OrderID string                `json:"order_id"`
+	Deaths  []death               `json:"x_death"`
+	Order   *pb.OrderCreatedEvent `json:"order,omitempty"`
+	Type    string                `json:"content_type"`
+	Body    []byte                `json:"body"` // 原始消息体(base64)
+	// 隔离队列中的消息带有失败原因与堆栈
+	Failure  string `json:"failure_reason,omitempty"`
+	Stack    string `json:"failure_stack,omitempty"`
+	ParkedAt string `json:"parked_at,omitempty"`
+}
+
+type death struct {
+	Queue       string    `json:"queue"`
+	Reason      string    `json:"reason"`
+	Count       int64     `json:"count"`
+	Exchange    string    `json:"exchange"`
+	RoutingKeys []string  `json:"routing_keys"`
+	Time        time.Time `json:"time"`
+}
+
+func main() {
+	action := flag.String("action", "list", "操作: list | replay | purge | export")
+	parking := flag.Bool("parking", false, "操作隔离队列(毒消息)而不是死信队列")
+	ids := flag.String("ids", "", "只处理指定订单号，逗号分隔")
+	all := flag.Bool("all", false, "处理全部消息(replay/purge 必须指定 -ids 或 -all)")
+	out := flag.String("out", "dead_letters.jsonl", "export 输出文件")
+	limit := flag.Int("limit", 0, "最多读取多少条，0 表示全部")
+	dryRun := flag.Bool("dry-run", false, "只打印将要执行的操作，消息全部放回死信队列")
+	flag.Parse()
+
+	selected := map[string]bool{}
+	for _, id := range strings.Split(*ids, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			selected[id] = true
+		}
+	}
+	if (*action == "replay" || *action == "purge") && len(selected) == 0 && !*all {
+		log.Fatalf("%s 需要指定 -ids 或 -all", *action)
+	}
+	match := func(d *deadLetter) bool { return *all || selected[d.OrderID] }
+
+	queue := mq.DeadQueue
+	if *parking {
+		queue = mq.ParkingQueue
+	}
+
+	// 队列类型等参数需与服务一致，否则重新声明队列会失败
+	config.InitConfig("mq")
+	if backend := broker.BackendName(); backend != broker.BackendRabbitMQ {
+		log.Fatalf("dlq_tool 只支持 mq.backend=rabbitmq，当前为 %s；redis 后端可用 XRANGE mq:stream:%s - + 查看死信", backend, queue)
+	}
+	// 重放前按订单扣减状态筛掉已补偿的订单，需与商品服务使用同一个 Redis 库
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     config.Conf.Redis.Addr,
+		Password: config.Conf.Redis.Password,
+		DB:       config.Conf.Redis.DB,
+	})
+	defer rdb.Close()
+
+	conn, err := amqp.Dial(broker.RabbitMQURL())
+	if err != nil {
+		log.Fatalf("连接RabbitMQ失败: %v", err)
+	}
+	defer conn.Close()
+	ch, err := conn.Channel()
+	if err != nil {
+		log.Fatalf("创建MQ通道失败: %v", err)
+	}
+	if err := mq.DeclareOrderTopology(ch); err != nil {
+		log.Fatalf("声明队列失败: %v", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		log.Fatalf("开启发布确认失败: %v", err)
+	}
+	// mandatory 发布无法路由时 Broker 会退回消息，不注册则退回被静默丢弃，重放看似成功
+	returns := ch.NotifyReturn(make(chan amqp.Return, 16))
+
+	var file *os.File
+	if *action == "export" && !*dryRun {
+		file, err = os.Create(*out)
+		if err != nil {
+			log.Fatalf("创建导出文件失败: %v", err)
+		}
+		defer file.Close()
+	}
+
+	// 放回死信队列的消息要等全部读完再 Nack，否则会被立即重新取到
+	var keep []amqp.Delivery
+	var handled, refused, total int
+	for *limit == 0 || total < *limit {
+		d, ok, err := ch.Get(queue, false)
+		if err != nil {
+			log.Fatalf("读取 %s 失败: %v", queue, err)
+		}
+		if !ok {
+			break
+		}
+		total++
+
+		dl := decode(d)
+		printDeadLetter(total, dl)
+
+		switch {
+		case *action == "export":
+			if file != nil {
+				line, _ := json.Marshal(dl)
+				if _, err := file.Write(append(line, '\n')); err != nil {
+					log.Fatalf("写入导出文件失败: %v", err)
+				}
+			}
+			handled++
+			keep = append(keep, d) // 导出不移除消息
+
+		case *action == "replay" && match(dl):
+			// 只有库存仍处于预扣状态的订单才能重放：死信补偿已回滚库存的订单，消费者收到重放也只会跳过
+			if reason := replayBlocked(rdb, dl); reason != "" {
+				refused++
+				fmt.Println("   ⏭️ 不重放:", reason)
+				keep = append(keep, d)
+				continue
+			}
+			handled++
+			if *dryRun {
+				fmt.Println("   [dry-run] 将重放到", mq.OrderQueue)
+				keep = append(keep, d)
+				continue
+			}
+			if err := replay(ch, returns, d); err != nil {
+				log.Printf("   ❌ 重放失败，消息保留在 %s: %v", queue, err)
+				keep = append(keep, d)
+				continue
+			}
+			d.Ack(false)
+			fmt.Println("   ✅ 已重放到", mq.OrderQueue)
+
+		case *action == "purge" && match(dl):
+			handled++
+			if *dryRun {
+				fmt.Println("   [dry-run] 将删除")
+				keep = append(keep, d)
+				continue
+			}
+			d.Ack(false)
+			fmt.Println("   🗑️ 已删除")
+
+		default:
+			keep = append(keep, d)
+		}
+	}
+
+	for _, d := range keep {
+		if err := d.Nack(false, true); err != nil {
+			log.Printf("放回 %s 失败(连接关闭后 Broker 会自动放回): %v", queue, err)
+		}
+	}
+
+	switch *action {
+	case "list":
+		fmt.Printf("%s 共 %d 条消息\n", queue, total)
+	case "export":
+		if *dryRun {
+			fmt.Printf("[dry-run] 将导出 %d 条消息到 %s\n", handled, *out)
+		} else {
+			fmt.Printf("已导出 %d 条消息到 %s\n", handled, *out)
+		}
+	case "replay":
+		fmt.Printf("共读取 %d 条消息，replay %d 条，拒绝重放 %d 条(仍保留在 %s)\n", total, handled, refused, queue)
+	default:
+		fmt.Printf("共读取 %d 条消息，%s %d 条\n", total, *action, handled)
+	}
+}
+
+// replayBlocked 按商品服务记录的订单扣减状态判断能否重放，返回拒绝原因
+// 死信补偿会回滚库存、把订单标记为失败并通知用户，这类订单重放后消费者会直接跳过，
+// 想恢复只能让用户重新下单
+func replayBlocked(rdb *redis.Client, dl *deadLetter) string {
+	if dl.Order == nil {
+		return "无法解析的消息"
+	}
+	state, err := rdb.Get(context.Background(), ledger.OrderStateKeyPrefix+dl.OrderID).Result()
+	switch {
+	case err == redis.Nil:
+		return "订单扣减状态已过期或不存在，无法确认库存是否仍被预留"
+	case err != nil:
+		return fmt.Sprintf("读取订单扣减状态失败: %v", err)
+	case state == "rolledback":
+		return "订单已由死信补偿回滚库存并通知用户失败，重放不会落库"
+	case state == "created":
+		return "订单已落库，无需重放"
+	case state != "deducted":
+		return "未知的订单扣减状态 " + state
+	}
+	return ""
+}
+
+// replay 把消息重新发布到订单队列，等 Broker 确认且未被退回才算成功
+// 重放的消息重新计算重试与投递次数
+func replay(ch *amqp.Channel, returns <-chan amqp.Return, d amqp.Delivery) error {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		if !replayStripHeaders[k] && !strings.HasPrefix(k, "x-first-death") && !strings.HasPrefix(k, "x-last-death") {
+			headers[k] = v
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	dc, err := ch.PublishWithDeferredConfirmWithContext(ctx, "", mq.OrderQueue, true, false, amqp.Publishing{
+		Headers:      headers,
+		ContentType:  d.ContentType,
+		Type:         d.Type,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    d.MessageId,
+		Body:         d.Body,
+	})
+	if err != nil {
+		return err
+	}
+	acked, err := dc.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return fmt.Errorf("MQ 拒绝了重放的消息")
+	}
+	// Broker 先发 basic.return 再发 basic.ack，收到确认时退回一定已在通道中；重放逐条进行，退回的只可能是这一条
+	if returned(returns) {
+		return fmt.Errorf("消息无法路由到 %s，已被退回", mq.OrderQueue)
+	}
+	return nil
+}
+
+// returned 取出通道中积压的退回消息，返回是否有退回
+func returned(returns <-chan amqp.Return) bool {
+	found := false
+	for {
+		select {
+		case _, ok := <-returns:
+			if !ok {
+				return found
+			}
+			found = true
+		default:
+			return found
+		}
+	}
+}
+
+func decode(d amqp.Delivery) *deadLetter {
+	dl := &deadLetter{OrderID: d.MessageId, Type: d.ContentType, Body: d.Body}
+	dl.Failure, _ = d.Headers[mq.FailureReasonHeader].(string)
+	dl.Stack, _ = d.Headers[mq.FailureStackHeader].(string)
+	dl.ParkedAt, _ = d.Headers[mq.ParkedAtHeader].(string)
+
+	if event, err := mq.DecodeOrderEvent(d.ContentType, d.Body); err == nil {
+		dl.Order = event
+		dl.OrderID = event.OrderId
+	}
+
+	deaths, _ := d.Headers["x-death"].([]interface{})
+	for _, item := range deaths {
+		t, ok := item.(amqp.Table)
+		if !ok {
+			continue
+		}
+		x := death{}
+		x.Queue, _ = t["queue"].(string)
+		x.Reason, _ = t["reason"].(string)
+		x.Count, _ = t["count"].(int64)
+		x.Exchange, _ = t["exchange"].(string)
+		x.Time, _ = t["time"].(time.Time)
+		keys, _ := t["routing-keys"].([]interface{})
+		for _, k := range keys {
+			if s, ok := k.(string); ok {
+				x.RoutingKeys = append(x.RoutingKeys, s)
+			}
+		}
+		dl.Deaths = append(dl.Deaths, x)
+	}
+	return dl
+}
+
+func printDeadLetter(n int, dl *deadLetter) {
+	if dl.Order != nil {
+		fmt.Printf("#%d 订单 %s | 用户 %d | 商品 %d | 数量 %d | 金额 %.2f | 版本 v%d\n",
+			n, dl.OrderID, dl.Order.UserId, dl.Order.ProductId, dl.Order.Count, dl.Order.Amount, dl.Order.Version)
+	} else {
+		fmt.Printf("#%d 无法解析的消息: %s\n", n, dl.Body)
+	}
+	if dl.Failure != "" {
+		fmt.Printf("   隔离原因: %s | 时间 %s\n", dl.Failure, dl.ParkedAt)
+	}
+	for _, x := range dl.Deaths {
+		fmt.Printf("   x-death: 队列 %s | 原因 %s | 次数 %d | 时间 %s\n",
+			x.Queue, x.Reason, x.Count, x.Time.Format("2006-01-02 15:04:05"))
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"seckill-mall/common/config"
+	"seckill-mall/common/ledger"
+)
+
+// 库存重建工具：以 MySQL 商品初始库存(或最近一次活动预热)为基准，叠加库存流水，重算 Redis 中的库存与用户已购数量
+// 注意：重建期间必须停止下单流量，否则重建结果会覆盖掉并发的扣减
+
+// 与 product_service 的数据库模型保持一致
+type Product struct {
+	ID    int64 `gorm:"primaryKey"`
+	Stock int32 `gorm:"type:int"`
+}
+
+func (Product) TableName() string { return "product" }
+
+// 每次从 MySQL 读取的流水条数
+const rebuildPageSize = 1000
+
+type productState struct {
+	stock   int64
+	users   map[int64]int64
+	cleaned bool // 活动已结束并清理，Redis 中不应再有该商品的 Key
+}
+
+func main() {
+	cfgName := flag.String("config", "product", "配置文件名(与商品服务共用 MySQL/Redis 配置)")
+	productID := flag.Int64("product", 0, "只重建指定商品，0 表示全部")
+	dryRun := flag.Bool("dry-run", false, "只打印重建结果，不写入 Redis")
+	flag.Parse()
+
+	config.InitConfig(*cfgName)
+	ctx := context.Background()
+
+	db, err := gorm.Open(mysql.Open(config.Conf.MySQL.DSN), &gorm.Config{})
+	if err != nil {
+		log.Fatalf("连接MySQL失败: %v", err)
+	}
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     config.Conf.Redis.Addr,
+		Password: config.Conf.Redis.Password,
+		DB:       config.Conf.Redis.DB,
+	})
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		log.Fatalf("连接 Redis 失败: %v", err)
+	}
+
+	// 1. 基准：商品表中的初始库存
+	var products []Product
+	q := db.Model(&Product{})
+	if *productID > 0 {
+		q = q.Where("id = ?", *productID)
+	}
+	if err := q.Find(&products).Error; err != nil {
+		log.Fatalf("查询商品失败: %v", err)
+	}
+	states := make(map[int64]*productState, len(products))
+	for _, p := range products {
+		states[p.ID] = &productState{stock: int64(p.Stock), users: map[int64]int64{}}
+	}
+
+	// 2. 还留在 Stream 中尚未落库的流水(XRANGE 按写入顺序返回)
+	// 已落库的流水会从 Stream 中删除，这里通常只剩少量积压
+	msgs, err := rdb.XRange(ctx, ledger.StreamKey, "-", "+").Result()
+	if err != nil {
+		log.Fatalf("读取库存流水 Stream 失败: %v", err)
+	}
+	var stream []*ledger.Entry
+	for _, m := range msgs {
+		e, err := ledger.FromMessage(m)
+		if err != nil {
+			log.Printf("跳过无法解析的流水: %v", err)
+			continue
+		}
+		if *productID > 0 && e.ProductID != *productID {
+			continue
+		}
+		stream = append(stream, e)
+	}
+
+	// 3. 已落库的流水按 (stream_ms, stream_seq) 分页读取，与 Stream 中的流水按写入顺序归并后回放
+	// 预热与清理流水把库存重置为绝对值，顺序错了结果就错
+	if err := db.AutoMigrate(&ledger.Entry{}); err != nil {
+		log.Fatalf("迁移库存流水表失败: %v", err)
+	}
+	if err := ledger.BackfillStreamOrder(db); err != nil {
+		log.Fatalf("补全流水排序列失败: %v", err)
+	}
+	total, pending := 0, 0
+	last := &ledger.Entry{}
+	for {
+		var page []*ledger.Entry
+		lq := db.Model(&ledger.Entry{}).
+			Where("(stream_ms > ? OR (stream_ms = ? AND stream_seq > ?))", last.StreamMs, last.StreamMs, last.StreamSeq).
+			Order("stream_ms, stream_seq").Limit(rebuildPageSize)
+		if *productID > 0 {
+			lq = lq.Where("product_id = ?", *productID)
+		}
+		if err := lq.Find(&page).Error; err != nil {
+			log.Fatalf("查询库存流水失败: %v", err)
+		}
+
+		for _, e := range page {
+			for len(stream) > 0 && stream[0].Before(e) {
+				apply(states, stream[0])
+				stream = stream[1:]
+				total++
+				pending++
+			}
+			// 已落库但还没从 Stream 中删除的流水只回放一次
+			if len(stream) > 0 && stream[0].StreamID == e.StreamID {
+				stream = stream[1:]
+			}
+			apply(states, e)
+			total++
+		}
+		if len(page) < rebuildPageSize {
+			break
+		}
+		last = page[len(page)-1]
+	}
+	for _, e := range stream {
+		apply(states, e)
+		total++
+		pending++
+	}
+	fmt.Printf("共 %d 条流水 (其中 %d 条尚未落库)\n", total, pending)
+
+	for id, st := range states {
+		stockKey := "product:stock:" + strconv.FormatInt(id, 10)
+		userSetKey := "product:users:" + strconv.FormatInt(id, 10)
+		if st.cleaned {
+			fmt.Printf("商品 %d => 活动已结束清理，跳过\n", id)
+			continue
+		}
+		fmt.Printf("商品 %d => 库存 %d, 购买用户 %d 人\n", id, st.stock, len(st.users))
+
+		if *dryRun {
+			continue
+		}
+
+		_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, stockKey, st.stock, 0)
+			pipe.Del(ctx, userSetKey)
+			for uid, n := range st.users {
+				if n > 0 {
+					pipe.HSet(ctx, userSetKey, strconv.FormatInt(uid, 10), n)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Fatalf("写回商品 %d 失败: %v", id, err)
+		}
+	}
+
+	if *dryRun {
+		fmt.Println("dry-run 模式，未写入 Redis")
+		return
+	}
+	fmt.Println("✅ 库存与限购计数已按流水重建")
+}
+
+// apply 把一条流水叠加到商品状态上
+func apply(states map[int64]*productState, e *ledger.Entry) {
+	st, ok := states[e.ProductID]
+	if !ok {
+		log.Printf("流水 %s 引用了不存在的商品 %d，已跳过", e.StreamID, e.ProductID)
+		return
+	}
+
+	switch e.Reason {
+	case ledger.ReasonPreheat:
+		// 活动预热会重置库存并清空购买记录，之前的流水不再影响当前状态
+		st.stock = e.StockAfter
+		st.users = map[int64]int64{}
+		st.cleaned = false
+	case ledger.ReasonCleanup:
+		st.cleaned = true
+	default:
+		st.stock += e.Delta
+		if e.UserDelta != 0 {
+			st.users[e.UserID] += e.UserDelta
+		}
+	}
+}
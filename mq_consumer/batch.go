@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"seckill-mall/common/broker"
+	"seckill-mall/common/config"
+	"seckill-mall/common/ledger"
+	"seckill-mall/common/mq"
+)
+
+// 默认消费参数，配置文件未指定时使用
+const (
+	defaultPrefetch  = 200
+	defaultWorkers   = 4
+	defaultBatchSize = 50
+	defaultBatchWait = 20 * time.Millisecond
+)
+
+// 去重表上线前已落库(没有去重记录)的订单保持不变，其他错误照常返回(不能用 INSERT IGNORE，会吞掉数据过长等错误)
+var ignoreDuplicate = clause.OnConflict{
+	Columns:   []clause.Column{{Name: "order_id"}},
+	DoUpdates: clause.AssignmentColumns([]string{"order_id"}),
+}
+
+func prefetch() int {
+	if config.Conf.MQ.Prefetch > 0 {
+		return config.Conf.MQ.Prefetch
+	}
+	return defaultPrefetch
+}
+
+// ackTracker 按通道跟踪投递标签：成功的消息攒到连续区间后用一次 multiple ack 确认
+// 单独 Nack/转投重试的消息先逐条确认，再标记为已处理，保证 multiple ack 不会越过未完成的消息
+type ackTracker struct {
+	mu      sync.Mutex
+	current broker.Acker
+	state   *ackState
+	retired map[broker.Acker]bool // 断线前的旧通道
+}
+
+type ackState struct {
+	next    uint64          // 最小的未处理标签
+	done    map[uint64]bool // 已处理但未越过水位的标签，true 表示等待 ack
+	pending uint64          // 水位之下等待 ack 的最大标签
+}
+
+func newAckTracker() *ackTracker {
+	return &ackTracker{retired: map[broker.Acker]bool{}}
+}
+
+// ack 标记处理成功，等待批量确认
+func (t *ackTracker) ack(ds ...broker.Delivery) {
+	for _, d := range ds {
+		t.mark(d, true)
+	}
+}
+
+// settled 标记已经单独确认(Nack 或转投后 Ack)的消息
+func (t *ackTracker) settled(d broker.Delivery) {
+	t.mark(d, false)
+}
+
+func (t *ackTracker) mark(d broker.Delivery, needAck bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.retired[d.Acker] {
+		return
+	}
+	if d.Acker != t.current {
+		// 重连后换了新通道，标签从 1 重新开始；旧通道上未确认的消息 Broker 会重新投递
+		if t.current != nil {
+			t.retired[t.current] = true
+		}
+		t.current = d.Acker
+		t.state = &ackState{next: 1, done: map[uint64]bool{}}
+	}
+	st := t.state
+	if d.Tag < st.next {
+		return
+	}
+
+	st.done[d.Tag] = needAck
+	for {
+		need, ok := st.done[st.next]
+		if !ok {
+			break
+		}
+		if need {
+			st.pending = st.next
+		}
+		delete(st.done, st.next)
+		st.next++
+	}
+
+	if st.pending > 0 {
+		if err := d.Acker.Ack(st.pending, true); err != nil {
+			log.Printf("批量确认失败(连接已断开，消息会被重新投递): %v", err)
+		}
+		st.pending = 0
+	}
+}
+
+// marked 消息是否已经确认或标记过，panic 后据此跳过已处理的消息，避免重复确认
+func (t *ackTracker) marked(d broker.Delivery) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.retired[d.Acker] {
+		return true
+	}
+	if d.Acker != t.current || t.state == nil {
+		return false
+	}
+	_, done := t.state.done[d.Tag]
+	return done || d.Tag < t.state.next
+}
+
+// runPipeline 把消息攒批后交给工作协程落库
+func runPipeline(b broker.Publisher, msgs <-chan broker.Delivery) {
+	workers := config.Conf.MQ.Workers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	size := config.Conf.MQ.BatchSize
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+	wait := config.Conf.MQ.BatchWait
+	if wait <= 0 {
+		wait = defaultBatchWait
+	}
+
+	tracker := newAckTracker()
+	batches := make(chan []broker.Delivery, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				safeProcess(b, tracker, batch)
+			}
+		}()
+	}
+
+	fmt.Printf("📧 消费者服务已启动 (prefetch %d, %d 个工作协程, 每批 %d 条)，等待订单中...\n", prefetch(), workers, size)
+
+	// 攒够一批或等待超时就发出，避免低峰期消息迟迟不落库
+	batch := make([]broker.Delivery, 0, size)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	flush := func() {
+		if len(batch) > 0 {
+			batches <- batch
+			batch = make([]broker.Delivery, 0, size)
+		}
+	}
+
+	for {
+		select {
+		case d, ok := <-msgs:
+			if !ok {
+				flush()
+				close(batches)
+				wg.Wait()
+				return
+			}
+			if isolated(d) {
+				batches <- []broker.Delivery{d}
+				continue
+			}
+			if len(batch) == 0 {
+				timer.Reset(wait)
+			}
+			batch = append(batch, d)
+			if len(batch) >= size {
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		}
+	}
+}
+
+// orderItem 批内一条待处理的订单消息
+type orderItem struct {
+	d     broker.Delivery
+	ctx   context.Context // 消费 span
+	order *Order
+}
+
+// processBatch 按订单号去重后整批落库：订单与去重记录在同一事务中写入，提交后再执行只生效一次的副作用
+// 整批失败时退化为逐条落库，按结果分别确认、重试或进入死信
+// 每条消息一个消费 span，接在订单服务投递 span 之下；落库 span 挂在消费 span 下并互相链接
+func processBatch(b broker.Publisher, tracker *ackTracker, batch []broker.Delivery) {
+	items := make([]*orderItem, 0, len(batch))
+	for _, d := range batch {
+		ctx, span := startProcessSpan(d)
+		defer span.End()
+
+		// 超过投递次数上限的毒消息移入隔离队列，不再反复处理
+		if screen(b, d) {
+			span.AddEvent("超过投递次数上限或重新计数")
+			tracker.settled(d)
+			continue
+		}
+
+		// 迁移期间同时兼容旧版 JSON 与 protobuf 消息
+		event, err := mq.DecodeOrderEvent(d.ContentType, d.Body)
+		if err != nil {
+			log.Printf("❌ 消息格式错误: %v", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "消息格式错误")
+			park(b, d, "malformed", "消息格式错误: "+err.Error()) // 重试没有意义，直接隔离
+			tracker.settled(d)
+			continue
+		}
+		items = append(items, &orderItem{d: d, ctx: ctx, order: &Order{
+			OrderID:   event.OrderId,
+			UserID:    event.UserId,
+			ProductID: event.ProductId,
+			Amount:    event.Amount,
+			Status:    1, // 已支付/处理中
+		}})
+	}
+	if len(items) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	ids := make([]string, 0, len(items))
+	stateKeys := make([]string, 0, len(items))
+	for _, it := range items {
+		ids = append(ids, it.order.OrderID)
+		stateKeys = append(stateKeys, ledger.OrderStateKeyPrefix+it.order.OrderID)
+	}
+
+	// 库存已被补偿回滚的订单(如死信重放)不能再落库，否则会超卖
+	states, err := rdb.MGet(ctx, stateKeys...).Result()
+	if err != nil {
+		states = make([]interface{}, len(stateKeys)) // Redis 故障时不拦截，由落库结果决定
+	}
+	// 重复投递的消息不再落库，副作用未完成的只补做副作用
+	seen, err := loadDedup(ctx, ids)
+	if err != nil {
+		seen = map[string]int{} // 查询失败时按未处理对待，由事务中的去重主键兜底
+	}
+
+	fresh := items[:0:0]
+	committed := items[:0:0]
+	for i, it := range items {
+		span := trace.SpanFromContext(it.ctx)
+		status, dup := seen[it.order.OrderID]
+		switch {
+		case dup && status == DedupDone:
+			fmt.Printf("♻️ 订单 %s 已处理过，重复消息直接确认\n", it.order.OrderID)
+			span.AddEvent("重复消息，跳过")
+			tracker.ack(it.d)
+		case dup:
+			committed = append(committed, it)
+		case states[i] == "rolledback":
+			// 库存已回滚(例如死信补偿)的订单已通知用户失败，不能再落库；dlq_tool 也会拒绝重放这类订单
+			fmt.Printf("⚠️ 订单 %s 库存已回滚，跳过\n", it.order.OrderID)
+			span.AddEvent("库存已回滚，跳过落库")
+			tracker.ack(it.d)
+		default:
+			fresh = append(fresh, it)
+		}
+	}
+
+	if len(fresh) > 0 {
+		if err := insertBatch(fresh); err == nil {
+			fmt.Printf("📦 批量落库 %d 条订单 -> ✅ 成功\n", len(fresh))
+			committed = append(committed, fresh...)
+		} else {
+			log.Printf("❌ 批量落库 %d 条失败: %v，改为逐条落库", len(fresh), err)
+			for _, it := range fresh {
+				if err := insertOne(it); err != nil {
+					trace.SpanFromContext(it.ctx).SetStatus(codes.Error, "落库失败")
+					handleFailure(b, it.d, it.order.OrderID, err)
+					tracker.settled(it.d)
+					continue
+				}
+				committed = append(committed, it)
+			}
+		}
+	}
+	finishEffects(b, tracker, committed)
+}
+
+// insertBatch 在一个事务中写入去重记录与订单
+// 并发的重复投递会在去重主键上冲突，整批回退后由逐条落库区分
+func insertBatch(items []*orderItem) error {
+	records := make([]*ConsumedMessage, 0, len(items))
+	orders := make([]*Order, 0, len(items))
+	links := make([]trace.Link, 0, len(items))
+	for _, it := range items {
+		records = append(records, dedupRecord(it.order.OrderID))
+		orders = append(orders, it.order)
+		links = append(links, trace.LinkFromContext(it.ctx))
+	}
+
+	dbCtx, dbSpan := startInsertSpan(items[0].ctx, links, len(items))
+	err := db.WithContext(dbCtx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(records, len(records)).Error; err != nil {
+			return err
+		}
+		return tx.Clauses(ignoreDuplicate).CreateInBatches(orders, len(orders)).Error
+	})
+	endSpan(dbSpan, err)
+	// 反向链接，从任意一条订单的链路都能找到这次批量写入
+	for _, it := range items[1:] {
+		trace.SpanFromContext(it.ctx).AddLink(trace.LinkFromContext(dbCtx))
+	}
+	return err
+}
+
+// insertOne 单条落库：去重记录已存在说明其他消费者已落库，只需补做副作用
+func insertOne(it *orderItem) error {
+	dbCtx, dbSpan := startInsertSpan(it.ctx, nil, 1)
+	err := db.WithContext(dbCtx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(skipDuplicate).Create(dedupRecord(it.order.OrderID))
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return tx.Clauses(ignoreDuplicate).Create(it.order).Error
+	})
+	endSpan(dbSpan, err)
+	return err
+}
+
+// finishEffects 对已落库的订单执行副作用，成功后确认消息；失败的转投延迟队列，重新投递时只补做副作用
+func finishEffects(b broker.Publisher, tracker *ackTracker, items []*orderItem) {
+	if len(items) == 0 {
+		return
+	}
+	ctx := context.Background()
+	orders := make([]*Order, 0, len(items))
+	for _, it := range items {
+		orders = append(orders, it.order)
+	}
+
+	errs := runEffects(ctx, orders)
+	done := make([]string, 0, len(items))
+	acked := make([]broker.Delivery, 0, len(items))
+	for i, it := range items {
+		if errs[i] != nil {
+			trace.SpanFromContext(it.ctx).SetStatus(codes.Error, "副作用执行失败")
+			handleFailure(b, it.d, it.order.OrderID, errs[i])
+			tracker.settled(it.d)
+			continue
+		}
+		done = append(done, it.order.OrderID)
+		acked = append(acked, it.d)
+	}
+	if len(done) > 0 {
+		if err := markEffectsDone(ctx, done); err != nil {
+			log.Printf("更新去重记录失败(不影响幂等): %v", err)
+		}
+	}
+	tracker.ack(acked...)
+}
+
+// handleFailure 永久错误直接进入死信，临时故障转投延迟队列
+func handleFailure(b broker.Publisher, d broker.Delivery, orderID string, err error) {
+	if !isRetryable(err) {
+		// 永久错误(数据本身有问题)，重试无意义，直接进入死信
+		log.Printf("订单 %s -> ❌ 处理失败(不可重试): %v，发送 Nack->进入死信", orderID, err)
+		d.Nack(false)
+		return
+	}
+
+	// 临时故障(数据库或 Redis 挂了/网络抖动)，转投延迟队列稍后重试
+	log.Printf("订单 %s -> ❌ 处理失败: %v", orderID, err)
+	retried, errRetry := retryLater(b, d)
+	switch {
+	case errRetry != nil:
+		// 转投失败，放回原队列，不能丢消息
+		log.Printf(" -> 转投重试队列失败: %v，消息重新入队", errRetry)
+		d.Nack(true)
+	case retried:
+		d.Ack()
+	default:
+		// 关键点：requeue=false + 配置了死信交换机 = 消息进入死信队列
+		log.Printf(" -> 已重试 %d 次仍失败，发送 Nack->进入死信", d.RetryCount())
+		d.Nack(false)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm/clause"
+
+	"seckill-mall/common/ledger"
+	"seckill-mall/common/notification"
+	"seckill-mall/common/pb"
+)
+
+// 去重记录状态
+const (
+	DedupCommitted = 0 // 订单已落库，副作用尚未完成
+	DedupDone      = 1 // 副作用已完成，重复投递直接确认
+)
+
+// 去重记录中的消费者名，其他消费者复用该表时各用各的名字
+const dedupConsumer = "order-consumer"
+
+// ConsumedMessage 消息去重表，与订单在同一事务中写入；订单消息以订单号作为消息 ID
+type ConsumedMessage struct {
+	Consumer  string    `gorm:"column:consumer;type:varchar(64);primaryKey"`
+	MessageID string    `gorm:"column:message_id;type:varchar(64);primaryKey"`
+	Status    int       `gorm:"column:status;not null;default:0"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at"`
+}
+
+func (ConsumedMessage) TableName() string { return "consumed_messages" }
+
+// 遇到已存在的去重记录时什么都不做，通过影响行数判断是否重复
+var skipDuplicate = clause.OnConflict{DoNothing: true}
+
+// 订单落库后的副作用，整段在 Redis 中原子执行且只执行一次：
+// 1. 库存状态由 deducted 回写为 created，之后的回滚请求不会再退回这笔库存
+// 2. 通知用户下单成功
+// KEYS[1] 副作用标记 KEYS[2] 订单库存状态 KEYS[3] 用户通知列表
+// ARGV[1] 标记与状态的过期秒数 ARGV[2] 通知 JSON ARGV[3] 通知保留条数
+const ORDER_EFFECTS_LUA = `
+if not redis.call("SET", KEYS[1], "1", "NX", "EX", ARGV[1]) then
+	return 0
+end
+if redis.call("GET", KEYS[2]) == "deducted" then
+	redis.call("SET", KEYS[2], "created", "EX", ARGV[1])
+end
+redis.call("LPUSH", KEYS[3], ARGV[2])
+redis.call("LTRIM", KEYS[3], 0, tonumber(ARGV[3]) - 1)
+return 1
+`
+
+// loadDedup 查询已处理过的消息及其状态
+func loadDedup(ctx context.Context, ids []string) (map[string]int, error) {
+	var rows []ConsumedMessage
+	err := db.WithContext(ctx).Where("consumer = ? AND message_id IN ?", dedupConsumer, ids).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]int, len(rows))
+	for _, r := range rows {
+		seen[r.MessageID] = r.Status
+	}
+	return seen, nil
+}
+
+func dedupRecord(orderID string) *ConsumedMessage {
+	return &ConsumedMessage{Consumer: dedupConsumer, MessageID: orderID, Status: DedupCommitted}
+}
+
+// runEffects 批量执行副作用，返回每条的错误；重复执行时脚本直接返回，不会重复通知
+func runEffects(ctx context.Context, orders []*Order) []error {
+	ttl := int(ledger.OrderStateTTL.Seconds())
+	pipe := rdb.Pipeline()
+	cmds := make([]*redis.Cmd, len(orders))
+	for i, o := range orders {
+		body, _ := json.Marshal(&pb.Notification{
+			Type:      "order_created",
+			Message:   "下单成功，订单已创建",
+			OrderId:   o.OrderID,
+			ProductId: o.ProductID,
+			CreatedAt: time.Now().Unix(),
+		})
+		keys := []string{"mq:effects:" + dedupConsumer + ":" + o.OrderID, ledger.OrderStateKeyPrefix + o.OrderID, notification.Key(o.UserID)}
+		cmds[i] = pipe.Eval(ctx, ORDER_EFFECTS_LUA, keys, ttl, string(body), notification.MaxItems)
+	}
+	pipe.Exec(ctx)
+
+	errs := make([]error, len(orders))
+	for i, cmd := range cmds {
+		errs[i] = cmd.Err()
+	}
+	return errs
+}
+
+// markEffectsDone 副作用完成后更新去重记录，之后的重复投递不再访问 Redis
+// 更新失败不影响正确性：再次投递时脚本会识别出已执行过
+func markEffectsDone(ctx context.Context, ids []string) error {
+	return db.WithContext(ctx).Model(&ConsumedMessage{}).
+		Where("consumer = ? AND message_id IN ?", dedupConsumer, ids).
+		Update("status", DedupDone).Error
+}
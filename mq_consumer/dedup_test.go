@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"seckill-mall/common/broker"
+	"seckill-mall/common/config"
+	"seckill-mall/common/ledger"
+	"seckill-mall/common/mq"
+	"seckill-mall/common/notification"
+	"seckill-mall/common/pb"
+)
+
+const (
+	testUserID    = 7
+	testProductID = 42
+)
+
+// setupConsumer 用 SQLite 与 miniredis 代替 MySQL 与 Redis，消息走内存 Broker
+func setupConsumer(t *testing.T) (*broker.Memory, *miniredis.Miniredis) {
+	t.Helper()
+	config.Conf = &config.Config{MQ: config.MQConfig{Backend: broker.BackendMemory}}
+
+	var err error
+	db, err = gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "orders.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // SQLite 同一时刻只允许一个写事务
+	if err := db.AutoMigrate(&Order{}, &ConsumedMessage{}); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+
+	mr := miniredis.RunT(t)
+	rdb = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	b := broker.NewOrderMemory()
+	t.Cleanup(func() {
+		b.Close()
+		rdb.Close()
+		sqlDB.Close()
+	})
+	return b, mr
+}
+
+// publishOrders 发布订单消息，同一订单号可重复发布
+func publishOrders(t *testing.T, b *broker.Memory, orderIDs ...string) {
+	t.Helper()
+	for _, id := range orderIDs {
+		msg, err := broker.OrderEventMessage(mq.NewOrderEvent(id, testUserID, testProductID, 1, 10))
+		if err != nil {
+			t.Fatalf("编码订单消息失败: %v", err)
+		}
+		if err := b.Publish(context.Background(), mq.OrderQueue, msg); err != nil {
+			t.Fatalf("发布订单消息失败: %v", err)
+		}
+	}
+}
+
+// receive 从订单队列取回 n 条投递作为一批
+func receive(t *testing.T, b *broker.Memory, n int) []broker.Delivery {
+	t.Helper()
+	msgs, stop := b.Consume(mq.OrderQueue, n)
+	defer stop()
+	batch := make([]broker.Delivery, 0, n)
+	for range n {
+		select {
+		case d := <-msgs:
+			batch = append(batch, d)
+		case <-time.After(time.Second):
+			t.Fatal("等待订单消息超时")
+		}
+	}
+	return batch
+}
+
+// deliver 发布订单消息并整批取回
+func deliver(t *testing.T, b *broker.Memory, orderIDs ...string) []broker.Delivery {
+	t.Helper()
+	publishOrders(t, b, orderIDs...)
+	return receive(t, b, len(orderIDs))
+}
+
+// markDeducted 模拟订单服务预扣库存后写入的订单状态
+func markDeducted(t *testing.T, orderID string) {
+	t.Helper()
+	if err := rdb.Set(context.Background(), ledger.OrderStateKeyPrefix+orderID, "deducted", 0).Err(); err != nil {
+		t.Fatalf("写入订单状态失败: %v", err)
+	}
+}
+
+// assertOnce 订单只落库一次、只通知一次、库存状态只回写一次，且所有投递都已确认
+func assertOnce(t *testing.T, b *broker.Memory, mr *miniredis.Miniredis, orderID string) {
+	t.Helper()
+	var orders int64
+	db.Model(&Order{}).Where("order_id = ?", orderID).Count(&orders)
+	if orders != 1 {
+		t.Errorf("订单 %s 应落库 1 次，实际 %d 次", orderID, orders)
+	}
+
+	var status int
+	db.Model(&ConsumedMessage{}).Select("status").
+		Where("consumer = ? AND message_id = ?", dedupConsumer, orderID).Scan(&status)
+	if status != DedupDone {
+		t.Errorf("去重记录状态应为 %d，实际 %d", DedupDone, status)
+	}
+
+	notified := 0
+	items, _ := mr.List(notification.Key(testUserID))
+	for _, item := range items {
+		var n pb.Notification
+		if json.Unmarshal([]byte(item), &n) == nil && n.OrderId == orderID {
+			notified++
+		}
+	}
+	if notified != 1 {
+		t.Errorf("订单 %s 应只通知 1 次，实际 %d 次", orderID, notified)
+	}
+
+	if state, _ := mr.Get(ledger.OrderStateKeyPrefix + orderID); state != "created" {
+		t.Errorf("订单状态应由 deducted 回写为 created，实际 %q", state)
+	}
+
+	// 确认过的消息不会重新投递
+	msgs, stop := b.Consume(mq.OrderQueue, 0)
+	defer stop()
+	select {
+	case d := <-msgs:
+		t.Errorf("订单 %s 有未确认的消息被重新投递", d.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// probeTransition 把订单状态改回 deducted 作为探针：之后若副作用再次执行，状态会又被回写为 created
+func probeTransition(t *testing.T, mr *miniredis.Miniredis, orderID string) {
+	t.Helper()
+	mr.Set(ledger.OrderStateKeyPrefix+orderID, "deducted")
+}
+
+func assertNoTransition(t *testing.T, mr *miniredis.Miniredis, orderID string) {
+	t.Helper()
+	if state, _ := mr.Get(ledger.OrderStateKeyPrefix + orderID); state != "deducted" {
+		t.Errorf("重复投递不应再次回写订单状态，实际 %q", state)
+	}
+}
+
+func TestRedeliveryOfCompletedMessage(t *testing.T) {
+	b, mr := setupConsumer(t)
+	markDeducted(t, "o1")
+
+	processBatch(b, newAckTracker(), deliver(t, b, "o1"))
+	assertOnce(t, b, mr, "o1")
+
+	// 已完成的消息再次投递：直接确认，不落库、不通知、不回写状态
+	probeTransition(t, mr, "o1")
+	processBatch(b, newAckTracker(), deliver(t, b, "o1"))
+	assertNoTransition(t, mr, "o1")
+	mr.Set(ledger.OrderStateKeyPrefix+"o1", "created")
+	assertOnce(t, b, mr, "o1")
+}
+
+func TestRedeliveryAfterCommitBeforeEffects(t *testing.T) {
+	b, mr := setupConsumer(t)
+	markDeducted(t, "o1")
+
+	// 订单与去重记录已提交，消费者在执行副作用前崩溃
+	batch := deliver(t, b, "o1")
+	it := &orderItem{d: batch[0], ctx: context.Background(), order: &Order{
+		OrderID: "o1", UserID: testUserID, ProductID: testProductID, Amount: 10, Status: 1,
+	}}
+	if err := insertBatch([]*orderItem{it}); err != nil {
+		t.Fatalf("落库失败: %v", err)
+	}
+	if seen, _ := loadDedup(context.Background(), []string{"o1"}); seen["o1"] != DedupCommitted {
+		t.Fatalf("去重记录应处于 DedupCommitted，实际 %v", seen)
+	}
+	// 崩溃后未确认的消息由 Broker 重新投递
+	batch[0].Nack(true)
+
+	processBatch(b, newAckTracker(), receive(t, b, 1))
+	assertOnce(t, b, mr, "o1")
+}
+
+func TestRedeliveryAfterEffectsBeforeMarkDone(t *testing.T) {
+	b, mr := setupConsumer(t)
+	markDeducted(t, "o1")
+
+	// 副作用已执行，但去重记录还没更新为 DedupDone 就崩溃
+	batch := deliver(t, b, "o1")
+	order := &Order{OrderID: "o1", UserID: testUserID, ProductID: testProductID, Amount: 10, Status: 1}
+	if err := insertBatch([]*orderItem{{d: batch[0], ctx: context.Background(), order: order}}); err != nil {
+		t.Fatalf("落库失败: %v", err)
+	}
+	if errs := runEffects(context.Background(), []*Order{order}); errs[0] != nil {
+		t.Fatalf("执行副作用失败: %v", errs[0])
+	}
+	batch[0].Nack(true)
+
+	// 重新投递时脚本识别出副作用已执行，不会再次通知或回写状态
+	probeTransition(t, mr, "o1")
+	processBatch(b, newAckTracker(), receive(t, b, 1))
+	assertNoTransition(t, mr, "o1")
+	mr.Set(ledger.OrderStateKeyPrefix+"o1", "created")
+	assertOnce(t, b, mr, "o1")
+}
+
+func TestConcurrentDuplicatesInOneBatch(t *testing.T) {
+	b, mr := setupConsumer(t)
+	markDeducted(t, "o1")
+	markDeducted(t, "o2")
+
+	// 同一订单的三条重复消息与另一订单同批到达：整批落库在去重主键上冲突，退化为逐条落库
+	processBatch(b, newAckTracker(), deliver(t, b, "o1", "o2", "o1", "o1"))
+
+	assertOnce(t, b, mr, "o1")
+	assertOnce(t, b, mr, "o2")
+}
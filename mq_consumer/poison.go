@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"seckill-mall/common/broker"
+	"seckill-mall/common/mq"
+)
+
+// 隔离消息中保留的堆栈长度，避免消息头过大
+const maxStackLen = 4096
+
+// 毒消息指标，reason: malformed 格式错误 / delivery_limit 超过投递次数上限
+var parkedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "seckill_mq_parked_total",
+	Help: "移入隔离队列的订单消息数",
+}, []string{"reason"})
+
+// headerCounted 经典队列不统计投递次数，崩溃后的重新投递只带 Redelivered 标记，由消费者在消息头中计数
+func headerCounted() bool {
+	return broker.BackendName() == broker.BackendRabbitMQ && !mq.IsQuorum()
+}
+
+// previousDeliveries 本条消息之前已投递的次数
+func previousDeliveries(d broker.Delivery) int {
+	n := d.DeliveryCount() + d.IntHeader(mq.RequeueCountHeader)
+	if d.Redelivered && headerCounted() {
+		n++
+	}
+	return n
+}
+
+// screen 处理前检查投递次数：超过上限的移入隔离队列；经典队列重新投递的消息带上计数重新入队
+// 返回 true 表示消息已处理(确认或放回)，不再落库
+func screen(b broker.Publisher, d broker.Delivery) bool {
+	prev := previousDeliveries(d)
+	if prev >= mq.DeliveryLimit() {
+		reason := fmt.Sprintf("已投递 %d 次仍未处理成功(消费者可能在处理时崩溃)", prev)
+		if last, _ := d.Headers[mq.FailureReasonHeader].(string); last != "" {
+			reason += "，最近一次失败: " + last
+		}
+		park(b, d, "delivery_limit", reason)
+		return true
+	}
+	if d.Redelivered && headerCounted() {
+		// 放到队尾，同时记下这次投递，再次崩溃时计数才能累加
+		requeueCounted(b, d, "", "")
+		return true
+	}
+	return false
+}
+
+// requeueCounted 把消息重新发布到订单队列末尾并累加重新入队次数，成功后确认原消息
+// 带失败原因的消息之后会被单独处理，不再拖累同批的正常消息
+func requeueCounted(b broker.Publisher, d broker.Delivery, reason, stack string) {
+	msg := copyHeaders(d)
+	msg.Headers[mq.RequeueCountHeader] = int32(d.IntHeader(mq.RequeueCountHeader) + 1)
+	if reason != "" {
+		msg.Headers[mq.FailureReasonHeader] = reason
+		msg.Headers[mq.FailureStackHeader] = stack
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.Publish(ctx, OrderQueue, msg); err != nil {
+		log.Printf("消息 %s 重新入队失败: %v，交给 Broker 放回", d.ID, err)
+		d.Nack(true)
+		return
+	}
+	d.Ack()
+}
+
+// park 把毒消息连同失败原因移入隔离队列，不触发死信补偿
+func park(b broker.Publisher, d broker.Delivery, kind, reason string) {
+	msg := copyHeaders(d)
+	msg.Headers[mq.FailureReasonHeader] = reason
+	msg.Headers[mq.ParkedAtHeader] = time.Now().Format(time.RFC3339)
+	msg.Headers[mq.OriginalQueueHeader] = OrderQueue
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.Publish(ctx, mq.ParkingQueue, msg); err != nil {
+		log.Printf("消息 %s 移入隔离队列失败: %v，交给 Broker 放回", d.ID, err)
+		d.Nack(true)
+		return
+	}
+	d.Ack()
+	parkedTotal.WithLabelValues(kind).Inc()
+	log.Printf("🚨 [ALERT] 消息 %s 已移入隔离队列 %s: %s", d.ID, mq.ParkingQueue, reason)
+}
+
+func copyHeaders(d broker.Delivery) broker.Message {
+	msg := d.Message
+	msg.Headers = make(map[string]interface{}, len(d.Headers)+4)
+	for k, v := range d.Headers {
+		msg.Headers[k] = v
+	}
+	msg.Deaths = nil
+	return msg
+}
+
+// isolated 曾导致 panic 的消息单独成批处理
+func isolated(d broker.Delivery) bool {
+	_, ok := d.Headers[mq.FailureStackHeader]
+	return ok
+}
+
+// safeProcess 处理一批消息，panic 时记录原因与堆栈，把尚未处理的消息重新入队并单独处理
+// 反复 panic 的毒消息超过投递上限后移入隔离队列，同批的正常消息不受影响
+func safeProcess(b broker.Publisher, tracker *ackTracker, batch []broker.Delivery) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		stack := string(debug.Stack())
+		log.Printf("🚨 处理 %d 条消息时 panic: %v\n%s", len(batch), r, stack)
+		if len(stack) > maxStackLen {
+			stack = strings.ToValidUTF8(stack[:maxStackLen], "")
+		}
+		for _, d := range batch {
+			if tracker.marked(d) {
+				continue
+			}
+			requeueCounted(b, d, fmt.Sprintf("panic: %v", r), stack)
+			tracker.settled(d)
+		}
+	}()
+	processBatch(b, tracker, batch)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"seckill-mall/common/broker"
+	"seckill-mall/common/config"
+	"seckill-mall/common/mq"
+)
+
+// 默认重试次数，配置文件未指定时使用
+const defaultMaxAttempts = 4
+
+// 重试无意义的 MySQL 错误：数据本身有问题或表结构不匹配
+var permanentMySQLErrors = map[uint16]bool{
+	1048: true, // 字段不能为空
+	1054: true, // 字段不存在
+	1146: true, // 表不存在
+	1264: true, // 数值越界
+	1292: true, // 时间格式错误
+	1366: true, // 字符集/数值格式错误
+	1406: true, // 数据过长
+	1452: true, // 外键约束
+}
+
+func maxAttempts() int {
+	if config.Conf.MQ.MaxAttempts > 0 {
+		return config.Conf.MQ.MaxAttempts
+	}
+	return defaultMaxAttempts
+}
+
+// isRetryable 区分可重试的临时故障(连接断开、死锁、锁等待超时等)与永久错误
+func isRetryable(err error) bool {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return !permanentMySQLErrors[myErr.Number]
+	}
+	// 其余多为连接断开、超时等网络错误，按临时故障处理
+	return true
+}
+
+// retryLater 把消息转投到对应档位的延迟队列，等 Broker 确认后调用方再 Ack 原消息
+// 返回 false 表示已用完重试次数，应进入死信
+func retryLater(pub broker.Publisher, d broker.Delivery) (bool, error) {
+	attempt := d.RetryCount() + 1 // 本次是第几次失败
+	if attempt >= maxAttempts() {
+		return false, nil
+	}
+
+	delays := mq.RetryDelays()
+	delay := delays[min(attempt, len(delays))-1]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg := d.Message
+	msg.Headers = make(map[string]interface{}, len(d.Headers)+1)
+	for k, v := range d.Headers {
+		msg.Headers[k] = v
+	}
+	msg.Headers[mq.RetryCountHeader] = int32(attempt)
+	msg.Deaths = nil
+
+	if err := pub.PublishDelayed(ctx, OrderQueue, msg, delay); err != nil {
+		return true, err
+	}
+
+	fmt.Printf(" -> 🔁 第%d次重试将在 %v 后进行\n", attempt, delay)
+	return true, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"seckill-mall/common/broker"
+	"seckill-mall/common/tracer"
+)
+
+var consumerTracer = otel.Tracer("mq-consumer")
+
+// startProcessSpan 以消息头中的上游链路(订单服务的投递 span)为父节点创建消费 span
+func startProcessSpan(d broker.Delivery) (context.Context, trace.Span) {
+	ctx := tracer.ExtractHeaders(context.Background(), d.Headers)
+	return consumerTracer.Start(ctx, OrderQueue+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystem(broker.BackendName()),
+			semconv.MessagingOperationProcess,
+			semconv.MessagingDestinationName(OrderQueue),
+			semconv.MessagingMessageID(d.ID),
+			attribute.Int("messaging.retry_count", d.RetryCount()),
+		))
+}
+
+// startInsertSpan 落库 span，挂在 parent 对应的消费 span 之下；整批落库时再链接批内所有消息
+func startInsertSpan(parent context.Context, links []trace.Link, n int) (context.Context, trace.Span) {
+	return consumerTracer.Start(parent, "INSERT orders",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			semconv.DBSystemMySQL,
+			semconv.DBOperation("INSERT"),
+			semconv.DBSQLTable("orders"),
+			semconv.MessagingBatchMessageCount(n),
+		))
+}
+
+// endSpan 结束 span，出错时记录错误
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
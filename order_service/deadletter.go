@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+
+	"seckill-mall/common/broker"
+	"seckill-mall/common/mq"
+	"seckill-mall/common/pb"
+	"seckill-mall/common/tracer"
+)
+
+// 死信订单告警指标，result: compensated 已补偿 / skipped 无需补偿 / unknown 无法识别
+var deadLetterTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "seckill_order_dead_letter_total",
+	Help: "进入死信队列的订单消息数",
+}, []string{"result"})
+
+// runDeadLetterProcessor 消费死信补偿队列：订单最终落库失败后退回库存与限购名额，标记订单失败并通知用户
+func runDeadLetterProcessor(stop <-chan struct{}) {
+	ctx := context.Background()
+	msgs, stopConsume := mqBroker.Consume(mq.CompensationQueue, 10)
+
+	fmt.Println("🪦 死信订单补偿协程已启动")
+	for {
+		var d broker.Delivery
+		var ok bool
+		select {
+		case <-stop:
+			// 当前消息已处理完，停止消费后未确认的预取消息由 Broker 放回队列
+			stopConsume()
+			for range msgs {
+			}
+			return
+		case d, ok = <-msgs:
+			if !ok {
+				return
+			}
+		}
+
+		// 死信保留了原消息头，补偿过程接在原下单链路上
+		mctx, span := otel.Tracer("order-service").Start(tracer.ExtractHeaders(ctx, d.Headers), mq.CompensationQueue+" process",
+			trace.WithSpanKind(trace.SpanKindConsumer))
+		err := compensateDeadLetter(mctx, d)
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+		if err != nil {
+			// 回滚失败放回队列稍后重试
+			log.Printf("死信订单补偿失败，稍后重试: %v", err)
+			time.Sleep(time.Second)
+			d.Nack(true)
+			continue
+		}
+		d.Ack()
+	}
+}
+
+func compensateDeadLetter(ctx context.Context, d broker.Delivery) error {
+	event, err := mq.DecodeOrderEvent(d.ContentType, d.Body)
+	if err != nil {
+		deadLetterTotal.WithLabelValues("unknown").Inc()
+		log.Printf("🚨 [ALERT] 死信队列中有无法解析的消息，需人工处理(原始消息保留在 %s): %v", mq.DeadQueue, err)
+		return nil
+	}
+
+	// 订单已经落库(例如死信被重放后成功)，不能再回滚
+	var created int64
+	if err := db.WithContext(ctx).Model(&Order{}).Where("order_id = ?", event.OrderId).Count(&created).Error; err != nil {
+		return err
+	}
+	if created > 0 {
+		deadLetterTotal.WithLabelValues("skipped").Inc()
+		return nil
+	}
+
+	var m OutboxMessage
+	err = db.WithContext(ctx).Where("order_id = ?", event.OrderId).First(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// 没有发件箱记录就不知道扣减数量，无法自动回滚
+		deadLetterTotal.WithLabelValues("unknown").Inc()
+		log.Printf("🚨 [ALERT] 死信订单 %s 没有发件箱记录，无法自动补偿，请人工处理", event.OrderId)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if m.Status == OutboxDead {
+		deadLetterTotal.WithLabelValues("skipped").Inc()
+		return nil
+	}
+
+	if err := rollbackOrderStock(m.OrderID, m.UserID, m.ProductID, m.Count); err != nil {
+		return err
+	}
+	setOutboxStatus(ctx, m.OrderID, OutboxDead, "订单落库失败: "+deathReason(d))
+
+	notify(ctx, m.UserID, &pb.Notification{
+		Type:      "order_failed",
+		Message:   "订单处理失败，库存与限购名额已退回",
+		OrderId:   m.OrderID,
+		ProductId: m.ProductID,
+	})
+	deadLetterTotal.WithLabelValues("compensated").Inc()
+	log.Printf("🚨 [ALERT] 订单 %s 进入死信队列，已退回库存并标记失败 (用户 %d, 商品 %d, 数量 %d)",
+		m.OrderID, m.UserID, m.ProductID, m.Count)
+	return nil
+}
+
+// deathReason 取最近一次死信的原因
+func deathReason(d broker.Delivery) string {
+	if len(d.Deaths) > 0 {
+		return fmt.Sprintf("%s@%s", d.Deaths[0].Reason, d.Deaths[0].Queue)
+	}
+	return "unknown"
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"seckill-mall/common/broker"
+	"seckill-mall/common/pb"
+	"seckill-mall/common/tracer"
+	"seckill-mall/common/utils"
+)
+
+// 发件箱状态
+const (
+	OutboxReserving = 0 // 已记录下单意图，正在扣减库存
+	OutboxReady     = 1 // 库存已扣减，等待投递到 MQ
+	OutboxSent      = 2 // 已投递
+	OutboxCancelled = 3 // 扣减失败或超时未完成，已回滚，无需投递
+	OutboxFailed    = 4 // 多次投递失败，已补偿回滚
+	OutboxDead      = 5 // 消费者落库失败进入死信，已补偿回滚
+)
+
+const (
+	outboxBatchSize   = 100
+	outboxMaxAttempts = 10
+	outboxMaxBackoff  = time.Minute
+	outboxPollPeriod  = 500 * time.Millisecond
+	// relay 认领一批记录后的租约：投递与补偿在事务外进行，租约到期前其他 relay 不会认领，
+	// 需大于一次投递的确认超时与一次回滚的超时之和
+	outboxLease = 30 * time.Second
+	// 超过该时间仍停留在 Reserving 的记录视为下单进程中途崩溃，需要回滚
+	outboxReserveTimeout = 30 * time.Second
+)
+
+// OutboxMessage 订单消息发件箱，先落 MySQL 再由 relay 投递，保证库存扣减与订单消息不丢失
+type OutboxMessage struct {
+	ID        uint64 `gorm:"column:id;primaryKey;autoIncrement"`
+	OrderID   string `gorm:"column:order_id;type:varchar(64);uniqueIndex;not null"`
+	UserID    int64  `gorm:"column:user_id;not null"`
+	ProductID int64  `gorm:"column:product_id;not null"`
+	Count     int32  `gorm:"column:count;not null"`
+	Payload   string `gorm:"column:payload;type:text"` // OrderCreatedEvent JSON，Ready 后写入
+	// 下单请求的链路上下文，relay 投递时恢复，使 MQ 与消费者的 span 接在同一条链路上
+	TraceContext string    `gorm:"column:trace_context;type:varchar(512)"`
+	Status       int       `gorm:"column:status;index:idx_outbox_status_retry,priority:1;not null"`
+	Attempts     int       `gorm:"column:attempts;not null;default:0"`
+	NextRetryAt  time.Time `gorm:"column:next_retry_at;index:idx_outbox_status_retry,priority:2"` // 被认领时为租约到期时间
+	LeaseToken   string    `gorm:"column:lease_token;type:varchar(32)"`                           // 最近一次认领的令牌，只有持有者能写回投递结果
+	LastError    string    `gorm:"column:last_error;type:varchar(512)"`
+	CreatedAt    time.Time `gorm:"column:created_at"`
+	UpdatedAt    time.Time `gorm:"column:updated_at"`
+}
+
+func (OutboxMessage) TableName() string { return "order_outbox" }
+
+// 发件箱消息体使用 proto 字段名的 JSON，便于直接在数据库中查看，也兼容迁移前写入的旧版 JSON
+var payloadFormat = protojson.MarshalOptions{UseProtoNames: true}
+
+// relay 唤醒信号，CreateOrder 写入 Ready 记录后立即触发一次投递
+var outboxWakeup = make(chan struct{}, 1)
+
+func wakeOutboxRelay() {
+	select {
+	case outboxWakeup <- struct{}{}:
+	default:
+	}
+}
+
+// reserveOutbox 扣减库存前先记录下单意图
+func reserveOutbox(ctx context.Context, orderID string, req *pb.CreateOrderRequest) error {
+	return db.WithContext(ctx).Create(&OutboxMessage{
+		OrderID:     orderID,
+		UserID:      req.UserId,
+		ProductID:   req.ProductId,
+		Count:       req.Count,
+		Status:      OutboxReserving,
+		NextRetryAt: time.Now(),
+	}).Error
+}
+
+// markOutboxReady 库存扣减成功后写入消息体，等待投递
+func markOutboxReady(ctx context.Context, orderID string, event *pb.OrderCreatedEvent) error {
+	body, _ := payloadFormat.Marshal(event)
+	res := db.WithContext(ctx).Model(&OutboxMessage{}).
+		Where("order_id = ? AND status = ?", orderID, OutboxReserving).
+		Updates(map[string]interface{}{
+			"status":        OutboxReady,
+			"payload":       string(body),
+			"trace_context": tracer.Marshal(ctx),
+			"next_retry_at": time.Now(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("订单 %s 已被取消", orderID)
+	}
+	wakeOutboxRelay()
+	return nil
+}
+
+// enqueueOrder 库存已扣减的订单直接写入 Ready 记录(候补/抽签)，重复写入同一订单忽略
+func enqueueOrder(ctx context.Context, event *pb.OrderCreatedEvent) error {
+	body, _ := payloadFormat.Marshal(event)
+	err := db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&OutboxMessage{
+		OrderID:      event.OrderId,
+		UserID:       event.UserId,
+		ProductID:    event.ProductId,
+		Count:        event.Count,
+		Payload:      string(body),
+		TraceContext: tracer.Marshal(ctx),
+		Status:       OutboxReady,
+		NextRetryAt:  time.Now(),
+	}).Error
+	if err == nil {
+		wakeOutboxRelay()
+	}
+	return err
+}
+
+func setOutboxStatus(ctx context.Context, orderID string, status int, reason string) {
+	err := db.WithContext(ctx).Model(&OutboxMessage{}).Where("order_id = ?", orderID).
+		Updates(map[string]interface{}{"status": status, "last_error": truncate(reason, 512)}).Error
+	if err != nil {
+		log.Printf("更新发件箱状态失败，订单 %s: %v", orderID, err)
+	}
+}
+
+// runOutboxRelay 投递 Ready 记录，并回滚超时未完成的下单意图
+// 收到 stop 后处理完当前批次再退出，避免已投递的消息没来得及标记
+func runOutboxRelay(stop <-chan struct{}) {
+	ctx := context.Background()
+	ticker := time.NewTicker(outboxPollPeriod)
+	defer ticker.Stop()
+
+	fmt.Println("📮 订单发件箱投递协程已启动")
+	for {
+		select {
+		case <-stop:
+			fmt.Println("📮 订单发件箱投递协程已退出")
+			return
+		case <-outboxWakeup:
+		case <-ticker.C:
+		}
+
+		for relayOutboxBatch(ctx) == outboxBatchSize && !stopped(stop) {
+		}
+		reconcileReserving(ctx)
+	}
+}
+
+var errMalformedOutbox = errors.New("发件箱消息格式错误")
+
+// relayOutboxBatch 投递一批消息，返回本批条数
+// 先在短事务中认领记录(写入租约)，投递与补偿回滚都在事务外进行，再逐条写回结果，
+// 慢的 Broker 或商品服务不会长时间占着行锁与数据库连接；relay 中途崩溃的记录在租约到期后被重新认领
+func relayOutboxBatch(ctx context.Context) int {
+	batch, token, err := claimOutboxBatch(ctx)
+	if err != nil {
+		log.Printf("认领发件箱记录失败: %v", err)
+		return 0
+	}
+
+	// 整批并发投递，同时等待确认的条数由 Broker 的发布连接池限制
+	// 之前已经失败到上限的记录(补偿回滚未完成)不再投递，直接补偿
+	results := make([]error, len(batch))
+	var wg sync.WaitGroup
+	for i := range batch {
+		m := &batch[i]
+		if m.Attempts >= outboxMaxAttempts {
+			continue
+		}
+		event := &pb.OrderCreatedEvent{}
+		if err := protojson.Unmarshal([]byte(m.Payload), event); err != nil {
+			results[i] = fmt.Errorf("%w: %v", errMalformedOutbox, err)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = publishOrder(tracer.Unmarshal(ctx, m.TraceContext), event)
+		}()
+	}
+	wg.Wait()
+
+	for i := range batch {
+		m := &batch[i]
+		if m.Attempts >= outboxMaxAttempts {
+			continue
+		}
+		if err := results[i]; errors.Is(err, errMalformedOutbox) {
+			log.Printf("X! 发件箱消息格式错误，订单 %s: %v", m.OrderID, err)
+			m.LastError = truncate(err.Error(), 512)
+			m.Attempts = outboxMaxAttempts
+		} else if errors.Is(err, broker.ErrUnroutable) || errors.Is(err, broker.ErrNacked) {
+			// 无法路由说明队列不存在；被 nack 说明 Broker 明确拒收了这条消息(如队列已满拒绝发布)，重试没有意义，直接补偿
+			// 确认超时、连接断开等结果不确定的错误才按退避重试
+			log.Printf("X! 订单 %s 消息被退回或拒收: %v", m.OrderID, err)
+			m.LastError = err.Error()
+			m.Attempts = outboxMaxAttempts
+		} else if err != nil {
+			m.Attempts++
+			m.LastError = truncate(err.Error(), 512)
+			backoff := time.Second << min(m.Attempts, 6)
+			m.NextRetryAt = time.Now().Add(min(backoff, outboxMaxBackoff))
+			log.Printf("投递订单 %s 失败(第%d次): %v", m.OrderID, m.Attempts, err)
+		} else {
+			m.Status = OutboxSent
+			fmt.Printf("下单请求已发送到MQ，订单ID: %s\n", m.OrderID)
+		}
+		// 需要补偿的记录保持 Ready 并继续持有租约，回滚完成前崩溃时由下一个认领者接着补偿
+		if m.Status == OutboxReady && m.Attempts >= outboxMaxAttempts {
+			m.NextRetryAt = time.Now().Add(outboxLease)
+		}
+	}
+	if err := finishOutbox(ctx, batch, token); err != nil {
+		log.Printf("写回发件箱投递结果失败，租约到期后重新投递: %v", err)
+		return len(batch)
+	}
+
+	var compensated []OutboxMessage
+	for i := range batch {
+		m := &batch[i]
+		if m.Status == OutboxReady && m.Attempts >= outboxMaxAttempts && compensateOutbox(ctx, m) {
+			compensated = append(compensated, *m)
+		}
+	}
+	if err := finishOutbox(ctx, compensated, token); err != nil {
+		// 回滚按订单号幂等，租约到期后重新认领会再补偿一次
+		log.Printf("写回发件箱补偿结果失败: %v", err)
+	}
+	return len(batch)
+}
+
+// claimOutboxBatch 认领一批到期的 Ready 记录，把 next_retry_at 推到租约到期时间并写入本次的令牌
+// 多实例部署时通过 SKIP LOCKED 互不抢同一批记录，事务内只有读写数据库
+func claimOutboxBatch(ctx context.Context) ([]OutboxMessage, string, error) {
+	var batch []OutboxMessage
+	token := utils.NewTokenID()
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_retry_at <= ?", OutboxReady, time.Now()).
+			Order("id").Limit(outboxBatchSize).Find(&batch).Error
+		if err != nil || len(batch) == 0 {
+			return err
+		}
+
+		ids := make([]uint64, len(batch))
+		for i := range batch {
+			ids[i] = batch[i].ID
+		}
+		return tx.Model(&OutboxMessage{}).Where("id IN ?", ids).
+			Updates(map[string]interface{}{"next_retry_at": time.Now().Add(outboxLease), "lease_token": token}).Error
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return batch, token, nil
+}
+
+// finishOutbox 在一个短事务中写回投递或补偿结果
+// 只更新仍由本次认领持有的记录：租约已过期并被其他 relay 重新认领的记录交给对方处理
+func finishOutbox(ctx context.Context, batch []OutboxMessage, token string) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i := range batch {
+			m := &batch[i]
+			res := tx.Model(&OutboxMessage{}).Where("id = ? AND lease_token = ?", m.ID, token).
+				Updates(map[string]interface{}{
+					"status":        m.Status,
+					"attempts":      m.Attempts,
+					"next_retry_at": m.NextRetryAt,
+					"last_error":    m.LastError,
+				})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				log.Printf("订单 %s 的发件箱租约已过期，结果交由重新认领的 relay 处理", m.OrderID)
+			}
+		}
+		return nil
+	})
+}
+
+// compensateOutbox 多次投递失败后回滚库存并通知用户，返回是否已补偿
+func compensateOutbox(ctx context.Context, m *OutboxMessage) bool {
+	log.Printf("订单 %s 投递失败超过 %d 次，正在执行回滚...", m.OrderID, outboxMaxAttempts)
+	if err := rollbackOrderStock(m.OrderID, m.UserID, m.ProductID, m.Count); err != nil {
+		// 回滚失败保持 Ready，租约到期后由下一次认领继续回滚
+		return false
+	}
+	m.Status = OutboxFailed
+	notify(ctx, m.UserID, &pb.Notification{
+		Type:      "order_failed",
+		Message:   "系统繁忙，下单失败，库存已退回",
+		OrderId:   m.OrderID,
+		ProductId: m.ProductID,
+	})
+	return true
+}
+
+// reconcileReserving 回滚长时间停留在 Reserving 的记录
+// 下单进程在扣减库存前后崩溃时会留下这类记录；回滚按订单号幂等，未扣减的订单不会多还库存
+func reconcileReserving(ctx context.Context) {
+	var stale []OutboxMessage
+	err := db.WithContext(ctx).Where("status = ? AND created_at < ?", OutboxReserving, time.Now().Add(-outboxReserveTimeout)).
+		Limit(outboxBatchSize).Find(&stale).Error
+	if err != nil {
+		log.Printf("查询超时下单意图失败: %v", err)
+		return
+	}
+
+	for _, m := range stale {
+		// 先抢占状态，防止仍在进行中的 CreateOrder 把它标记为 Ready
+		res := db.WithContext(ctx).Model(&OutboxMessage{}).
+			Where("order_id = ? AND status = ?", m.OrderID, OutboxReserving).
+			Updates(map[string]interface{}{"status": OutboxCancelled, "last_error": "下单超时未完成"})
+		if res.Error != nil || res.RowsAffected == 0 {
+			continue
+		}
+
+		if err := rollbackOrderStock(m.OrderID, m.UserID, m.ProductID, m.Count); err != nil {
+			// 回滚失败恢复为 Reserving，下次继续对账
+			setOutboxStatus(ctx, m.OrderID, OutboxReserving, err.Error())
+			continue
+		}
+		log.Printf("订单 %s 下单未完成，已回滚", m.OrderID)
+	}
+}
+
+// rollbackOrderStock 按订单号回滚库存，使用独立 Context 避免被上游超时取消
+func rollbackOrderStock(orderID string, userID, productID int64, count int32) error {
+	rollbackCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	resp, err := productClient.RollbackStock(rollbackCtx, &pb.DeductStockRequest{
+		ProductId: productID,
+		Count:     count,
+		UserId:    userID,
+		OrderId:   orderID,
+	})
+	if err == nil && !resp.Success {
+		err = fmt.Errorf("%s", resp.Message)
+	}
+	if err != nil {
+		log.Printf("X! 回滚库存失败，请人工介入，CRITICAL ERROR: 订单 %s: %v", orderID, err)
+		return err
+	}
+	log.Printf("库存回滚成功，订单 %s", orderID)
+	return nil
+}
+
+// stopped 非阻塞地检查是否已收到关闭信号
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"seckill-mall/common/broker"
+	"seckill-mall/common/config"
+	"seckill-mall/common/mq"
+	"seckill-mall/common/pb"
+)
+
+const (
+	testStock     = 10
+	testProductID = 1
+)
+
+// fakeProduct 商品服务替身，按订单号幂等扣减与回滚，语义与商品服务的 Lua 脚本一致
+type fakeProduct struct {
+	pb.ProductServiceClient
+
+	mu     sync.Mutex
+	stock  int32
+	states map[string]string // 订单号 -> deducted / rolledback
+
+	// afterDeduct 扣减成功、应答返回前调用，用于模拟对账协程抢在下单流程之前
+	afterDeduct func(orderID string)
+}
+
+func (p *fakeProduct) DeductStock(ctx context.Context, req *pb.DeductStockRequest, _ ...grpc.CallOption) (*pb.DeductStockResponse, error) {
+	p.mu.Lock()
+	switch state := p.states[req.OrderId]; {
+	case state == "deducted":
+	case state != "":
+		p.mu.Unlock()
+		return &pb.DeductStockResponse{Success: false, Message: "订单已回滚"}, nil
+	case p.stock < req.Count:
+		p.mu.Unlock()
+		return &pb.DeductStockResponse{Success: false, Message: "库存不足"}, nil
+	default:
+		p.stock -= req.Count
+		p.states[req.OrderId] = "deducted"
+	}
+	p.mu.Unlock()
+
+	if p.afterDeduct != nil {
+		p.afterDeduct(req.OrderId)
+	}
+	return &pb.DeductStockResponse{Success: true, Message: "扣减成功"}, nil
+}
+
+func (p *fakeProduct) RollbackStock(ctx context.Context, req *pb.DeductStockRequest, _ ...grpc.CallOption) (*pb.DeductStockResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.states[req.OrderId] != "deducted" {
+		return &pb.DeductStockResponse{Success: true, Message: "无需回滚"}, nil
+	}
+	p.states[req.OrderId] = "rolledback"
+	p.stock += req.Count
+	return &pb.DeductStockResponse{Success: true, Message: "回滚成功"}, nil
+}
+
+func (p *fakeProduct) GetProduct(ctx context.Context, req *pb.ProductRequest, _ ...grpc.CallOption) (*pb.ProductResponse, error) {
+	return &pb.ProductResponse{ProductId: req.ProductId, Price: 10}, nil
+}
+
+// setupOutbox 用 SQLite、miniredis 与内存 Broker 代替 MySQL、Redis 与 RabbitMQ
+func setupOutbox(t *testing.T) *fakeProduct {
+	t.Helper()
+	config.Conf = &config.Config{MQ: config.MQConfig{Backend: broker.BackendMemory}}
+
+	var err error
+	db, err = gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "outbox.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // SQLite 同一时刻只允许一个写事务
+	if err := db.AutoMigrate(&OutboxMessage{}); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+
+	mr := miniredis.RunT(t)
+	rdb = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	mqBroker = broker.NewOrderMemory()
+	product := &fakeProduct{stock: testStock, states: map[string]string{}}
+	productClient = product
+	t.Cleanup(func() {
+		mqBroker.Close()
+		rdb.Close()
+		sqlDB.Close()
+	})
+	return product
+}
+
+// createOrderRequest 一次下单请求
+func createOrderRequest(userID int64) *pb.CreateOrderRequest {
+	return &pb.CreateOrderRequest{UserId: userID, ProductId: testProductID, Count: 1}
+}
+
+// expireReserving 把下单意图的创建时间提前到超时之前，模拟崩溃后过了对账周期
+func expireReserving(t *testing.T, orderID string) {
+	t.Helper()
+	err := db.Model(&OutboxMessage{}).Where("order_id = ?", orderID).
+		Update("created_at", time.Now().Add(-2*outboxReserveTimeout)).Error
+	if err != nil {
+		t.Fatalf("修改下单意图时间失败: %v", err)
+	}
+}
+
+// outboxStatus 查询发件箱记录状态
+func outboxStatus(t *testing.T, orderID string) int {
+	t.Helper()
+	var m OutboxMessage
+	if err := db.Where("order_id = ?", orderID).First(&m).Error; err != nil {
+		t.Fatalf("查询发件箱记录 %s 失败: %v", orderID, err)
+	}
+	return m.Status
+}
+
+// publishedOrders 取出订单队列中的全部消息并确认，返回每个订单号的消息条数
+// 消费者按订单号去重落库，因此不同订单号的个数就是最终的订单数
+func publishedOrders(t *testing.T) map[string]int {
+	t.Helper()
+	msgs, stop := mqBroker.Consume(mq.OrderQueue, 0)
+	defer stop()
+
+	orders := map[string]int{}
+	for {
+		select {
+		case d := <-msgs:
+			event, err := mq.DecodeOrderEvent(d.ContentType, d.Body)
+			if err != nil {
+				t.Fatalf("订单消息格式错误: %v", err)
+			}
+			orders[event.OrderId]++
+			d.Ack()
+		case <-time.After(50 * time.Millisecond):
+			return orders
+		}
+	}
+}
+
+// assertStockMatchesOrders 已扣减的库存必须等于最终订单数：既不丢单也不漏还库存
+func assertStockMatchesOrders(t *testing.T, product *fakeProduct, orders map[string]int) {
+	t.Helper()
+	product.mu.Lock()
+	deducted := testStock - product.stock
+	product.mu.Unlock()
+	if int(deducted) != len(orders) {
+		t.Fatalf("已扣减库存 %d 与订单数 %d 不一致: %v", deducted, len(orders), orders)
+	}
+}
+
+func TestOutboxHappyPath(t *testing.T) {
+	product := setupOutbox(t)
+	ctx := context.Background()
+
+	for userID := int64(1); userID <= 3; userID++ {
+		resp, err := (&server{}).CreateOrder(ctx, createOrderRequest(userID))
+		if err != nil || !resp.Success {
+			t.Fatalf("下单失败: %v %v", resp, err)
+		}
+	}
+	if n := relayOutboxBatch(ctx); n != 3 {
+		t.Fatalf("应投递 3 条，实际 %d", n)
+	}
+
+	orders := publishedOrders(t)
+	if len(orders) != 3 {
+		t.Fatalf("应有 3 个订单，实际 %v", orders)
+	}
+	assertStockMatchesOrders(t, product, orders)
+}
+
+func TestCrashAfterReserveBeforeDeduct(t *testing.T) {
+	product := setupOutbox(t)
+	ctx := context.Background()
+
+	// 记录下单意图后进程崩溃，库存还没扣减
+	if err := reserveOutbox(ctx, "o1", createOrderRequest(1)); err != nil {
+		t.Fatalf("记录下单意图失败: %v", err)
+	}
+
+	// 未超时的意图可能仍在进行中，对账不处理
+	reconcileReserving(ctx)
+	if status := outboxStatus(t, "o1"); status != OutboxReserving {
+		t.Fatalf("未超时的意图不应被取消，状态 %d", status)
+	}
+
+	expireReserving(t, "o1")
+	reconcileReserving(ctx)
+	if status := outboxStatus(t, "o1"); status != OutboxCancelled {
+		t.Fatalf("超时的意图应被取消，状态 %d", status)
+	}
+
+	relayOutboxBatch(ctx)
+	orders := publishedOrders(t)
+	if len(orders) != 0 {
+		t.Fatalf("取消的意图不应投递: %v", orders)
+	}
+	// 从未扣减的订单回滚时不会多还库存
+	assertStockMatchesOrders(t, product, orders)
+}
+
+func TestCrashAfterDeductBeforeReady(t *testing.T) {
+	product := setupOutbox(t)
+	ctx := context.Background()
+
+	// 扣减成功后、写入消息体前进程崩溃
+	req := createOrderRequest(1)
+	if err := reserveOutbox(ctx, "o1", req); err != nil {
+		t.Fatalf("记录下单意图失败: %v", err)
+	}
+	_, err := productClient.DeductStock(ctx, &pb.DeductStockRequest{
+		ProductId: req.ProductId, Count: req.Count, UserId: req.UserId, OrderId: "o1",
+	})
+	if err != nil {
+		t.Fatalf("扣减失败: %v", err)
+	}
+
+	expireReserving(t, "o1")
+	reconcileReserving(ctx)
+	if status := outboxStatus(t, "o1"); status != OutboxCancelled {
+		t.Fatalf("超时的意图应被取消，状态 %d", status)
+	}
+	// 重复对账不会重复回滚
+	reconcileReserving(ctx)
+
+	relayOutboxBatch(ctx)
+	orders := publishedOrders(t)
+	if len(orders) != 0 {
+		t.Fatalf("取消的意图不应投递: %v", orders)
+	}
+	assertStockMatchesOrders(t, product, orders)
+}
+
+func TestReconcileRacesWithCreateOrder(t *testing.T) {
+	product := setupOutbox(t)
+	ctx := context.Background()
+
+	// 下单流程在扣减后卡住超过超时时间，对账协程先取消并回滚，之后下单流程才继续
+	product.afterDeduct = func(orderID string) {
+		expireReserving(t, orderID)
+		reconcileReserving(ctx)
+	}
+	if _, err := (&server{}).CreateOrder(ctx, createOrderRequest(1)); err == nil {
+		t.Fatal("意图已被对账取消，下单应失败")
+	}
+
+	relayOutboxBatch(ctx)
+	orders := publishedOrders(t)
+	if len(orders) != 0 {
+		t.Fatalf("取消的订单不应投递: %v", orders)
+	}
+	assertStockMatchesOrders(t, product, orders)
+}
+
+func TestRelayCrashAfterPublishBeforeSent(t *testing.T) {
+	product := setupOutbox(t)
+	ctx := context.Background()
+
+	resp, err := (&server{}).CreateOrder(ctx, createOrderRequest(1))
+	if err != nil || !resp.Success {
+		t.Fatalf("下单失败: %v %v", resp, err)
+	}
+
+	// relay 已投递并收到确认，但还没把记录标记为已投递就崩溃
+	var m OutboxMessage
+	if err := db.Where("order_id = ?", resp.OrderId).First(&m).Error; err != nil {
+		t.Fatalf("查询发件箱记录失败: %v", err)
+	}
+	event := &pb.OrderCreatedEvent{}
+	if err := protojson.Unmarshal([]byte(m.Payload), event); err != nil {
+		t.Fatalf("发件箱消息体格式错误: %v", err)
+	}
+	if err := publishOrder(ctx, event); err != nil {
+		t.Fatalf("投递失败: %v", err)
+	}
+	if status := outboxStatus(t, resp.OrderId); status != OutboxReady {
+		t.Fatalf("崩溃前记录应仍为 Ready，状态 %d", status)
+	}
+
+	// 重启后 relay 再次投递同一订单(至少一次)，由消费者按订单号去重
+	if n := relayOutboxBatch(ctx); n != 1 {
+		t.Fatalf("应重新投递 1 条，实际 %d", n)
+	}
+	if status := outboxStatus(t, resp.OrderId); status != OutboxSent {
+		t.Fatalf("重新投递后应标记为已投递，状态 %d", status)
+	}
+	if n := relayOutboxBatch(ctx); n != 0 {
+		t.Fatalf("已投递的记录不应再次投递，实际 %d", n)
+	}
+
+	orders := publishedOrders(t)
+	if orders[resp.OrderId] != 2 {
+		t.Fatalf("订单 %s 应投递 2 次，实际 %v", resp.OrderId, orders)
+	}
+	assertStockMatchesOrders(t, product, orders)
+}
+
+func TestRelayCrashAfterClaim(t *testing.T) {
+	product := setupOutbox(t)
+	ctx := context.Background()
+
+	resp, err := (&server{}).CreateOrder(ctx, createOrderRequest(1))
+	if err != nil || !resp.Success {
+		t.Fatalf("下单失败: %v %v", resp, err)
+	}
+
+	// relay 认领后、投递前崩溃：租约到期前其他 relay 不会重复认领
+	batch, staleToken, err := claimOutboxBatch(ctx)
+	if err != nil || len(batch) != 1 {
+		t.Fatalf("认领失败: %v %v", batch, err)
+	}
+	if n := relayOutboxBatch(ctx); n != 0 {
+		t.Fatalf("租约未到期的记录不应被再次认领，实际 %d", n)
+	}
+
+	// 租约到期后重新认领并投递
+	err = db.Model(&OutboxMessage{}).Where("order_id = ?", resp.OrderId).
+		Update("next_retry_at", time.Now().Add(-time.Second)).Error
+	if err != nil {
+		t.Fatalf("修改租约到期时间失败: %v", err)
+	}
+	if n := relayOutboxBatch(ctx); n != 1 {
+		t.Fatalf("租约到期后应重新投递 1 条，实际 %d", n)
+	}
+	if status := outboxStatus(t, resp.OrderId); status != OutboxSent {
+		t.Fatalf("重新投递后应标记为已投递，状态 %d", status)
+	}
+
+	// 崩溃的 relay 恢复后用旧令牌写回结果，不会覆盖新的认领者
+	batch[0].Attempts = outboxMaxAttempts
+	if err := finishOutbox(ctx, batch, staleToken); err != nil {
+		t.Fatalf("写回失败: %v", err)
+	}
+	if status := outboxStatus(t, resp.OrderId); status != OutboxSent {
+		t.Fatalf("过期租约不应覆盖投递结果，状态 %d", status)
+	}
+
+	orders := publishedOrders(t)
+	if orders[resp.OrderId] != 1 {
+		t.Fatalf("订单 %s 应投递 1 次，实际 %v", resp.OrderId, orders)
+	}
+	assertStockMatchesOrders(t, product, orders)
+}
+
+// nackBroker 模拟 Broker 拒收所有消息
+type nackBroker struct{ broker.Broker }
+
+func (nackBroker) Publish(context.Context, string, broker.Message) error { return broker.ErrNacked }
+
+func TestRelayCompensatesNackedOrder(t *testing.T) {
+	product := setupOutbox(t)
+	ctx := context.Background()
+
+	resp, err := (&server{}).CreateOrder(ctx, createOrderRequest(1))
+	if err != nil || !resp.Success {
+		t.Fatalf("下单失败: %v %v", resp, err)
+	}
+
+	// 被 nack 的消息不按退避重试，一次投递后立即回滚库存
+	memory := mqBroker
+	mqBroker = nackBroker{memory}
+	relayOutboxBatch(ctx)
+	mqBroker = memory
+	if status := outboxStatus(t, resp.OrderId); status != OutboxFailed {
+		t.Fatalf("被拒收的订单应已补偿，状态 %d", status)
+	}
+
+	orders := publishedOrders(t)
+	if len(orders) != 0 {
+		t.Fatalf("被拒收的订单不应投递: %v", orders)
+	}
+	assertStockMatchesOrders(t, product, orders)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"seckill-mall/common/broker"
+	"seckill-mall/common/mq"
+	"seckill-mall/common/pb"
+	"seckill-mall/common/tracer"
+)
+
+var confirmLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "seckill_mq_confirm_seconds",
+	Help:    "订单消息从发布到收到 Broker 确认的耗时",
+	Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+}, []string{"result"}) // ack / nack / returned / timeout / error
+
+// publishOrder 发送订单消息，等待 Broker 确认后才算成功
+// 被 nack、退回或确认超时都返回错误：nack 与退回由调用方立即补偿，超时等结果不确定的错误由调用方重试
+// ctx 携带下单请求的链路上下文，以 W3C traceparent 写入消息头，消费者据此接上同一条链路
+func publishOrder(ctx context.Context, event *pb.OrderCreatedEvent) error {
+	msg, err := broker.OrderEventMessage(event)
+	if err != nil {
+		return err
+	}
+
+	ctx, span := otel.Tracer("order-service").Start(ctx, mq.OrderQueue+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystem(broker.BackendName()),
+			semconv.MessagingOperationPublish,
+			semconv.MessagingDestinationName(mq.OrderQueue),
+			semconv.MessagingMessageID(event.OrderId),
+		))
+	defer span.End()
+	msg.Headers = map[string]interface{}{}
+	tracer.InjectHeaders(ctx, msg.Headers)
+
+	start := time.Now()
+	err = mqBroker.Publish(ctx, mq.OrderQueue, msg)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	result := "ack"
+	switch {
+	case err == nil:
+	case errors.Is(err, broker.ErrNacked):
+		result = "nack"
+	case errors.Is(err, broker.ErrUnroutable):
+		result = "returned"
+	case errors.Is(err, context.DeadlineExceeded):
+		result = "timeout"
+	default:
+		result = "error"
+	}
+	confirmLatency.WithLabelValues(result).Observe(time.Since(start).Seconds())
+	return err
+}
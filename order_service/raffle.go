@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"seckill-mall/common/config"
+	"seckill-mall/common/ledger"
+	"seckill-mall/common/mq"
+	"seckill-mall/common/pb"
+	"seckill-mall/common/raffle"
+	"seckill-mall/common/utils"
+)
+
+const (
+	raffleStatusPending     = "未开始"
+	raffleStatusRegistering = "登记中"
+	raffleStatusWaiting     = "待开奖"
+	raffleStatusDrawn       = "已开奖"
+
+	raffleLockTTL = 5 * time.Minute
+)
+
+// 抽签相关 Redis Key
+// raffle:{pid}:seed    开奖种子(登记期间只公开其承诺值)
+// raffle:{pid}:users   报名用户 Set
+// raffle:{pid}:participants 开奖时的参与名单快照(UserID 升序，逗号分隔)，重跑与公开都使用这份名单
+// raffle:{pid}:result  开奖结果 Hash: seed/digest/participants/winners/status/drawn_at
+// raffle:{pid}:orders  中签用户 -> 订单号 Hash，开奖中断后重跑时据此跳过已处理用户
+// raffle:{pid}:pending 中签用户 -> 预分配订单号，重跑时沿用同一订单号
+// raffle:{pid}:lock    开奖锁，值为持有者的随机令牌，保证只有一个实例开奖
+func raffleKey(productID int64, suffix string) string {
+	return "raffle:" + strconv.FormatInt(productID, 10) + ":" + suffix
+}
+
+// 释放开奖锁：只删除自己持有的锁。开奖超过锁有效期时锁可能已被其他实例获取，不能误删
+// KEYS[1] 锁 Key  ARGV[1] 加锁时写入的令牌
+const RELEASE_RAFFLE_LOCK_LUA = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+    redis.call('DEL', KEYS[1])
+    return 1
+end
+return 0
+`
+
+var releaseRaffleLock = redis.NewScript(RELEASE_RAFFLE_LOCK_LUA)
+
+// RegisterRaffle 登记抽签
+func (s *server) RegisterRaffle(ctx context.Context, req *pb.RaffleRequest) (*pb.RaffleResponse, error) {
+	activity := config.GetActivity(req.ProductId)
+	if !activity.IsRaffle() {
+		return &pb.RaffleResponse{Success: false, Message: "该商品不是抽签发售"}, nil
+	}
+
+	status, err := raffleStatus(ctx, activity)
+	if err != nil {
+		return nil, err
+	}
+	if status != raffleStatusRegistering {
+		return &pb.RaffleResponse{Success: false, Message: "当前不在登记时间内", Status: status}, nil
+	}
+
+	// 第一个报名的人触发生成种子，此后种子不再改变
+	seedKey := raffleKey(req.ProductId, "seed")
+	if err := rdb.SetNX(ctx, seedKey, raffle.NewSeed(), 0).Err(); err != nil {
+		return nil, err
+	}
+
+	added, err := rdb.SAdd(ctx, raffleKey(req.ProductId, "users"), req.UserId).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.GetRaffle(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Success = true
+	resp.Message = "登记成功"
+	if added == 0 {
+		resp.Message = "您已登记过，请等待开奖"
+	}
+	return resp, nil
+}
+
+// GetRaffle 查询抽签状态与结果，开奖后公开种子以便复现
+func (s *server) GetRaffle(ctx context.Context, req *pb.RaffleRequest) (*pb.RaffleResponse, error) {
+	activity := config.GetActivity(req.ProductId)
+	if !activity.IsRaffle() {
+		return &pb.RaffleResponse{Success: false, Message: "该商品不是抽签发售"}, nil
+	}
+
+	status, err := raffleStatus(ctx, activity)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.RaffleResponse{Success: true, Status: status}
+	resp.Participants, err = rdb.SCard(ctx, raffleKey(req.ProductId, "users")).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	seed, _ := rdb.Get(ctx, raffleKey(req.ProductId, "seed")).Result()
+	if seed != "" {
+		resp.Commitment = raffle.Commitment(seed)
+	}
+
+	if status != raffleStatusDrawn {
+		return resp, nil
+	}
+
+	result, err := rdb.HGetAll(ctx, raffleKey(req.ProductId, "result")).Result()
+	if err != nil {
+		return nil, err
+	}
+	resp.Seed = result["seed"]
+	resp.ParticipantsDigest = result["digest"]
+	resp.Participants, _ = strconv.ParseInt(result["participants"], 10, 64)
+	resp.Winners, _ = strconv.ParseInt(result["winners"], 10, 64)
+
+	orderID, err := rdb.HGet(ctx, raffleKey(req.ProductId, "orders"), strconv.FormatInt(req.UserId, 10)).Result()
+	if err == nil {
+		resp.Won = true
+		resp.OrderId = orderID
+	}
+	return resp, nil
+}
+
+// GetRaffleParticipants 开奖后公开参与名单快照，与公开的摘要一致，可直接作为 raffle_verify 的输入
+func (s *server) GetRaffleParticipants(ctx context.Context, req *pb.RaffleRequest) (*pb.RaffleParticipantsResponse, error) {
+	activity := config.GetActivity(req.ProductId)
+	if !activity.IsRaffle() {
+		return &pb.RaffleParticipantsResponse{Success: false, Message: "该商品不是抽签发售"}, nil
+	}
+
+	result, err := rdb.HGetAll(ctx, raffleKey(req.ProductId, "result")).Result()
+	if err != nil {
+		return nil, err
+	}
+	if result["status"] != raffleStatusDrawn {
+		return &pb.RaffleParticipantsResponse{Success: false, Message: "尚未开奖，开奖后公开参与名单"}, nil
+	}
+
+	participants, err := raffleParticipants(ctx, req.ProductId)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.RaffleParticipantsResponse{
+		Success:            true,
+		ParticipantsDigest: result["digest"],
+		Participants:       participants,
+	}, nil
+}
+
+// raffleParticipants 读取开奖时的参与名单快照；快照上线前已开奖的活动回退到报名 Set(开奖后不再变化)
+func raffleParticipants(ctx context.Context, productID int64) ([]int64, error) {
+	snapshot, err := rdb.Get(ctx, raffleKey(productID, "participants")).Result()
+	if err == redis.Nil {
+		members, err := rdb.SMembers(ctx, raffleKey(productID, "users")).Result()
+		if err != nil {
+			return nil, err
+		}
+		return parseUserIDs(members), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if snapshot == "" {
+		return []int64{}, nil
+	}
+	return parseUserIDs(strings.Split(snapshot, ",")), nil
+}
+
+// parseUserIDs 解析 UserID 并按升序排列，与摘要的计算顺序一致
+func parseUserIDs(members []string) []int64 {
+	ids := make([]int64, 0, len(members))
+	for _, m := range members {
+		if uid, err := strconv.ParseInt(m, 10, 64); err == nil {
+			ids = append(ids, uid)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func raffleStatus(ctx context.Context, a *config.ActivityConfig) (string, error) {
+	drawn, err := rdb.HGet(ctx, raffleKey(a.ProductID, "result"), "status").Result()
+	if err == nil && drawn == raffleStatusDrawn {
+		return raffleStatusDrawn, nil
+	}
+
+	start, err1 := config.ParseTime(a.RegisterStart)
+	end, err2 := config.ParseTime(a.RegisterEnd)
+	if err1 != nil || err2 != nil {
+		return "", fmt.Errorf("活动 %d 登记时间配置有误", a.ProductID)
+	}
+
+	now := time.Now()
+	switch {
+	case now.Before(start):
+		return raffleStatusPending, nil
+	case end.IsZero() || now.Before(end):
+		return raffleStatusRegistering, nil
+	default:
+		return raffleStatusWaiting, nil
+	}
+}
+
+// runRaffleScheduler 到开奖时间后开奖，多实例通过 Redis 锁保证只开一次
+func runRaffleScheduler(stop <-chan struct{}) {
+	ctx := context.Background()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		for i := range config.Activities {
+			a := &config.Activities[i]
+			if !a.IsRaffle() {
+				continue
+			}
+			drawAt, err := config.ParseTime(a.DrawAt)
+			if err != nil || drawAt.IsZero() || time.Now().Before(drawAt) {
+				continue
+			}
+			if status, _ := rdb.HGet(ctx, raffleKey(a.ProductID, "result"), "status").Result(); status == raffleStatusDrawn {
+				continue
+			}
+
+			lockKey := raffleKey(a.ProductID, "lock")
+			token := utils.NewTokenID()
+			ok, err := rdb.SetNX(ctx, lockKey, token, raffleLockTTL).Result()
+			if err != nil || !ok {
+				continue
+			}
+			if err := drawRaffle(ctx, a); err != nil {
+				log.Printf("X! 商品 %d 开奖失败，将在下次调度时重试: %v", a.ProductID, err)
+			}
+			if released, _ := releaseRaffleLock.Run(ctx, rdb, []string{lockKey}, token).Int(); released == 0 {
+				log.Printf("商品 %d 开奖耗时超过锁有效期 %v，锁已过期或被其他实例持有", a.ProductID, raffleLockTTL)
+			}
+		}
+	}
+}
+
+// drawRaffle 开奖并为中签者走正常的 MQ 下单流程
+// 开奖中途崩溃后重跑：种子、名额与名单不变，抽签结果相同，已处理的中签者会被跳过
+func drawRaffle(ctx context.Context, a *config.ActivityConfig) error {
+	count := a.RaffleCount
+	if count <= 0 {
+		count = 1
+	}
+
+	seedKey := raffleKey(a.ProductID, "seed")
+	resultKey := raffleKey(a.ProductID, "result")
+	ordersKey := raffleKey(a.ProductID, "orders")
+	pendingKey := raffleKey(a.ProductID, "pending")
+
+	// 无人报名时也生成种子，保证结果可公开
+	if err := rdb.SetNX(ctx, seedKey, raffle.NewSeed(), 0).Err(); err != nil {
+		return err
+	}
+	seed, err := rdb.Get(ctx, seedKey).Result()
+	if err != nil {
+		return err
+	}
+
+	// 名额与参与名单只在第一次开奖时确定，名单快照与摘要同时写入，之后重跑与公开都使用快照
+	var participants []int64
+	winners, err := rdb.HGet(ctx, resultKey, "winners").Int()
+	if err == nil {
+		if participants, err = raffleParticipants(ctx, a.ProductID); err != nil {
+			return err
+		}
+	} else {
+		members, err := rdb.SMembers(ctx, raffleKey(a.ProductID, "users")).Result()
+		if err != nil {
+			return err
+		}
+		participants = parseUserIDs(members)
+
+		stock, err := rdb.Get(ctx, "product:stock:"+strconv.FormatInt(a.ProductID, 10)).Int()
+		if err != nil {
+			return fmt.Errorf("读取库存失败(是否已预热?): %v", err)
+		}
+		winners = stock / int(count)
+
+		ids := make([]string, len(participants))
+		for i, uid := range participants {
+			ids[i] = strconv.FormatInt(uid, 10)
+		}
+		_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, raffleKey(a.ProductID, "participants"), strings.Join(ids, ","), 0)
+			pipe.HSet(ctx, resultKey,
+				"seed", seed,
+				"digest", raffle.ParticipantsDigest(participants),
+				"participants", len(participants),
+				"winners", winners,
+			)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	pResp, err := productClient.GetProduct(ctx, &pb.ProductRequest{ProductId: a.ProductID})
+	if err != nil {
+		return err
+	}
+
+	picked := raffle.Draw(seed, participants, winners)
+	log.Printf("🎲 商品%d开奖：种子 %s，报名 %d 人，中签 %d 人", a.ProductID, seed, len(participants), len(picked))
+
+	for _, uid := range picked {
+		field := strconv.FormatInt(uid, 10)
+		if done, _ := rdb.HExists(ctx, ordersKey, field).Result(); done {
+			continue
+		}
+
+		// 预分配订单号，重跑时沿用，便于按订单号核对流水
+		rdb.HSetNX(ctx, pendingKey, field, utils.GenerateOrderID())
+		orderID, err := rdb.HGet(ctx, pendingKey, field).Result()
+		if err != nil {
+			return err
+		}
+
+		deductResp, err := productClient.DeductStock(ctx, &pb.DeductStockRequest{
+			ProductId: a.ProductID,
+			Count:     count,
+			UserId:    uid,
+			OrderId:   orderID,
+			Reason:    ledger.ReasonRaffle,
+		})
+		if err != nil {
+			return err
+		}
+		if !deductResp.Success {
+			log.Printf("中签用户 %d 扣减库存失败: %s", uid, deductResp.Message)
+			continue
+		}
+
+		err = enqueueOrder(ctx, mq.NewOrderEvent(orderID, uid, a.ProductID, count, pResp.Price*float32(count)))
+		if err != nil {
+			log.Printf("写入订单发件箱失败: %v，正在执行回滚...", err)
+			rollbackOrderStock(orderID, uid, a.ProductID, count)
+			return err
+		}
+
+		rdb.HSet(ctx, ordersKey, field, orderID)
+		notify(ctx, uid, &pb.Notification{
+			Type:      "raffle_won",
+			Message:   "恭喜中签，已为您自动下单",
+			OrderId:   orderID,
+			ProductId: a.ProductID,
+		})
+	}
+
+	return rdb.HSet(ctx, resultKey, "status", raffleStatusDrawn, "drawn_at", time.Now().Format(config.TimeLayout)).Err()
+}
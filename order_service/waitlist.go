@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"seckill-mall/common/mq"
+	"seckill-mall/common/notification"
+	"seckill-mall/common/pb"
+	"seckill-mall/common/waitlist"
+)
+
+const (
+	allocationMinBackoff = time.Second
+	allocationMaxBackoff = 30 * time.Second
+)
+
+// runWaitlistWorker 消费商品服务写入的候补分配结果，代用户下单并通知
+// 分配经 BLMOVE 移入本实例的处理中列表，写入发件箱(或回滚)后才删除，进程崩溃也不会丢失已扣减库存的分配；
+// BLMOVE 不随关闭信号取消，否则可能出现服务端已移走、客户端却没收到的分配
+func runWaitlistWorker(stop <-chan struct{}) {
+	ctx := context.Background()
+	processingKey := waitlist.ProcessingKey(waitlistInstance())
+	reclaimAllocations(ctx, processingKey)
+	fmt.Println("候补下单协程已启动")
+
+	var backoff time.Duration
+	for !stopped(stop) {
+		raw, err := rdb.BLMove(ctx, waitlist.AllocationKey, processingKey, "LEFT", "RIGHT", 5*time.Second).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			log.Printf("读取候补分配失败: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		var alloc waitlist.Allocation
+		if err := json.Unmarshal([]byte(raw), &alloc); err != nil {
+			log.Printf("X! 候补分配格式错误，CRITICAL ERROR: %v, 原始数据: %s", err, raw)
+			rdb.LRem(ctx, processingKey, 1, raw)
+			continue
+		}
+
+		if err := handleAllocation(ctx, alloc); err != nil {
+			// 临时故障(商品服务、数据库不可用)：放回队尾稍后重试，不能回滚，否则库存会被依次转给后面的候补用户，同样失败后整条候补队列被清空
+			backoff = min(max(backoff*2, allocationMinBackoff), allocationMaxBackoff)
+			log.Printf("候补下单暂时失败，订单 %s 将在 %v 后重试: %v", alloc.OrderID, backoff, err)
+			requeueAllocation(ctx, processingKey, raw)
+			select {
+			case <-stop:
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		backoff = 0
+		if err := rdb.LRem(ctx, processingKey, 1, raw).Err(); err != nil {
+			// 留在处理中列表，重启时会再处理一次；发件箱与回滚都按订单号幂等
+			log.Printf("移除已处理的候补分配失败，订单 %s: %v", alloc.OrderID, err)
+		}
+	}
+}
+
+// waitlistInstance 本实例的稳定标识(主机名+端口)，重启后仍能找回上次处理中的分配
+func waitlistInstance() string {
+	host, _ := os.Hostname()
+	port := viper.GetString("server.port")
+	if port == "" {
+		port = "50052"
+	}
+	return host + ":" + port
+}
+
+// reclaimAllocations 把上次崩溃时处理中的分配按原顺序放回队首
+func reclaimAllocations(ctx context.Context, processingKey string) {
+	n := 0
+	for {
+		err := rdb.LMove(ctx, processingKey, waitlist.AllocationKey, "RIGHT", "LEFT").Err()
+		if err == redis.Nil {
+			break
+		}
+		if err != nil {
+			log.Printf("回收处理中的候补分配失败: %v", err)
+			return
+		}
+		n++
+	}
+	if n > 0 {
+		log.Printf("♻️ 已回收上次未处理完的候补分配 %d 条", n)
+	}
+}
+
+// requeueAllocation 把分配从处理中列表移回队尾，两步在同一事务中完成
+func requeueAllocation(ctx context.Context, processingKey, raw string) {
+	pipe := rdb.TxPipeline()
+	pipe.LRem(ctx, processingKey, 1, raw)
+	pipe.RPush(ctx, waitlist.AllocationKey, raw)
+	if _, err := pipe.Exec(ctx); err != nil {
+		// 仍在处理中列表，重启时回收
+		log.Printf("候补分配放回队列失败: %v", err)
+	}
+}
+
+// handleAllocation 代用户下单；永久性错误(如商品不存在)回滚库存交给下一位候补用户，
+// 临时故障返回错误，由调用方稍后重试
+func handleAllocation(ctx context.Context, alloc waitlist.Allocation) error {
+	pResp, err := productClient.GetProduct(ctx, &pb.ProductRequest{ProductId: alloc.ProductID})
+	if err == nil {
+		err = enqueueOrder(ctx, mq.NewOrderEvent(alloc.OrderID, alloc.UserID, alloc.ProductID, alloc.Count, pResp.Price*float32(alloc.Count)))
+	}
+	if err != nil && !permanentError(err) {
+		return err
+	}
+
+	if err != nil {
+		// 下单失败把库存还回去，商品服务会继续分给下一位候补用户
+		log.Printf("候补下单失败: %v，正在执行回滚...", err)
+		return rollbackOrderStock(alloc.OrderID, alloc.UserID, alloc.ProductID, alloc.Count)
+	}
+
+	fmt.Printf("候补下单成功，用户: %d, 订单ID: %s\n", alloc.UserID, alloc.OrderID)
+	notify(ctx, alloc.UserID, &pb.Notification{
+		Type:      "waitlist_allocated",
+		Message:   "您候补的商品已有库存，已为您自动下单",
+		OrderId:   alloc.OrderID,
+		ProductId: alloc.ProductID,
+	})
+	return nil
+}
+
+// permanentError 重试也不会成功的错误；数据库错误与其他 gRPC 错误都视为临时故障
+func permanentError(err error) bool {
+	switch status.Code(err) {
+	case codes.NotFound, codes.InvalidArgument:
+		return true
+	}
+	return false
+}
+
+// notify 写入用户通知列表(最新的在前)
+func notify(ctx context.Context, userID int64, n *pb.Notification) {
+	n.CreatedAt = time.Now().Unix()
+	body, _ := json.Marshal(n)
+
+	key := notification.Key(userID)
+	pipe := rdb.Pipeline()
+	pipe.LPush(ctx, key, body)
+	pipe.LTrim(ctx, key, 0, notification.MaxItems-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("写入用户 %d 通知失败: %v", userID, err)
+	}
+}
+
+// GetNotifications 查询用户通知
+func (s *server) GetNotifications(ctx context.Context, req *pb.NotificationRequest) (*pb.NotificationResponse, error) {
+	key := notification.Key(req.UserId)
+	items, err := rdb.LRange(ctx, key, 0, notification.MaxItems-1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.NotificationResponse{}
+	for _, item := range items {
+		var n pb.Notification
+		if err := json.Unmarshal([]byte(item), &n); err != nil {
+			continue
+		}
+		resp.Notifications = append(resp.Notifications, &n)
+	}
+	return resp, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm/clause"
+
+	"seckill-mall/common/ledger"
+)
+
+const (
+	ledgerBatchSize = 100
+	ledgerBlockTime = 2 * time.Second
+	// 超过该时长未确认的流水视为持有者已退出(消费者名带 PID，重启后换名)，由存活的实例认领落库
+	ledgerClaimIdle = time.Minute
+)
+
+// startLedgerDrainer 把 Redis Stream 中的库存流水搬运到 MySQL
+// 多实例共用同一个消费者组，每条流水只会被一个实例落库
+// 收到 stop 后落库并确认完当前批次再退出
+func startLedgerDrainer(stop <-chan struct{}) {
+	if err := db.AutoMigrate(&ledger.Entry{}); err != nil {
+		log.Printf("❌ 库存流水表初始化失败，流水暂不落库: %v", err)
+		return
+	}
+
+	ctx := context.Background()
+	consumer := instanceName()
+
+	ensureLedgerGroup(ctx)
+	fmt.Printf("📒 库存流水落库已启动 (consumer: %s)\n", consumer)
+
+	// startID 为 "0" 时重读自己名下未确认的流水(落库失败后重试)，处理完再读新流水；
+	// 消费者名每次启动都不同，已退出实例名下的流水由 claimStaleLedger 认领
+	startID := "0"
+	var lastClaim time.Time
+	for {
+		if stopped(stop) {
+			fmt.Println("📒 库存流水落库已退出")
+			return
+		}
+
+		if time.Since(lastClaim) >= ledgerClaimIdle/2 {
+			lastClaim = time.Now()
+			if err := claimStaleLedger(ctx, consumer); err != nil {
+				log.Printf("认领遗留库存流水失败，稍后重试: %v", err)
+			}
+		}
+
+		streams, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    ledger.GroupName,
+			Consumer: consumer,
+			Streams:  []string{ledger.StreamKey, startID},
+			Count:    ledgerBatchSize,
+			Block:    ledgerBlockTime,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			// /dev/reset 会 FlushDB，消费者组随之消失，需要重建
+			if strings.Contains(err.Error(), "NOGROUP") {
+				ensureLedgerGroup(ctx)
+				continue
+			}
+			log.Printf("读取库存流水失败: %v", err)
+			pause(stop, time.Second)
+			continue
+		}
+
+		if len(streams) == 0 || len(streams[0].Messages) == 0 {
+			if startID == "0" {
+				startID = ">" // 遗留流水处理完毕
+			}
+			continue
+		}
+
+		if err := drainLedger(ctx, streams[0].Messages); err != nil {
+			log.Printf("库存流水落库失败，稍后重试: %v", err)
+			startID = "0"
+			pause(stop, time.Second)
+		}
+	}
+}
+
+// claimStaleLedger 用 XAUTOCLAIM 把长时间未确认的流水(持有者已崩溃或退出)转到自己名下并落库
+func claimStaleLedger(ctx context.Context, consumer string) error {
+	start := "0-0"
+	for {
+		msgs, next, err := rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   ledger.StreamKey,
+			Group:    ledger.GroupName,
+			Consumer: consumer,
+			MinIdle:  ledgerClaimIdle,
+			Start:    start,
+			Count:    ledgerBatchSize,
+		}).Result()
+		if err != nil {
+			if strings.Contains(err.Error(), "NOGROUP") {
+				ensureLedgerGroup(ctx)
+			}
+			return err
+		}
+		if len(msgs) > 0 {
+			fmt.Printf("📒 认领 %d 条遗留库存流水\n", len(msgs))
+			if err := drainLedger(ctx, msgs); err != nil {
+				return err
+			}
+		}
+		// 游标回到 0-0 表示已扫描完整个待确认列表
+		if next == "0-0" {
+			return nil
+		}
+		start = next
+	}
+}
+
+// stopped 非阻塞地检查是否已收到关闭信号
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// pause 等待 d，收到关闭信号时提前返回
+func pause(stop <-chan struct{}, d time.Duration) {
+	select {
+	case <-stop:
+	case <-time.After(d):
+	}
+}
+
+// instanceName 当前实例标识，用于消费者名与调度锁
+func instanceName() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+func ensureLedgerGroup(ctx context.Context) {
+	err := rdb.XGroupCreateMkStream(ctx, ledger.StreamKey, ledger.GroupName, "0").Err()
+	if err != nil && !strings.Contains(err.Error(), "BUSYGROUP") {
+		log.Printf("创建库存流水消费者组失败: %v", err)
+	}
+}
+
+// drainLedger 批量落库后确认并删除 Stream 中的流水，保持 Stream 体积可控
+func drainLedger(ctx context.Context, msgs []redis.XMessage) error {
+	entries := make([]*ledger.Entry, 0, len(msgs))
+	ids := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		ids = append(ids, m.ID)
+		e, err := ledger.FromMessage(m)
+		if err != nil {
+			// 格式错误的流水落库也没有意义，记录后跳过
+			log.Printf("X! 无法解析的库存流水，CRITICAL ERROR: %v", err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	if len(entries) > 0 {
+		// stream_id 唯一，重复落库直接忽略
+		err := db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(entries, ledgerBatchSize).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	pipe := rdb.TxPipeline()
+	pipe.XAck(ctx, ledger.StreamKey, ledger.GroupName, ids...)
+	pipe.XDel(ctx, ledger.StreamKey, ids...)
+	_, err := pipe.Exec(ctx)
+	return err
+}
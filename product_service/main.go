@@ -2,22 +2,28 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"seckill-mall/common/config"
+	"seckill-mall/common/graceful"
 	"strconv"
+	"sync"
 
 	"github.com/spf13/viper"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/naming/endpoints"
 
+	"seckill-mall/common/ledger"
 	"seckill-mall/common/pb"
 
 	// 引入 Redis 库
@@ -35,17 +41,36 @@ const (
 
 // 定义 Lua 脚本
 // KEYS[1]: 商品的 Redis Key (例如 product:stock:1)
+// KEYS[2]: 用户购买记录 Hash
+// KEYS[3]: 库存流水 Stream
+// KEYS[4]: 候补队列 List
+// KEYS[5]: 活动限购 Key (预热时写入，不存在时使用 ARGV[3])
+// KEYS[6]: 售罄标记 Key
+// KEYS[7]: 分波放量未放出的库存 Key
+// KEYS[8]: 订单扣减状态 Key
 // ARGV[1]: 要扣减的数量
+// ARGV[2]: 用户ID  ARGV[3]: 默认限购数量  ARGV[4]: 商品ID  ARGV[5]: 订单号  ARGV[6]: 变更原因
+// ARGV[7]: 订单状态保留秒数
 const LUA_SCRIPT = `
 -- 商品Key不存在（未预热/错误ID）
 if redis.call("EXISTS", KEYS[1]) == 0 then
 	return 0
 end
 
+-- 同一订单重复扣减直接返回之前的结果(幂等)
+if ARGV[5] ~= "" then
+	local state = redis.call("GET", KEYS[8])
+	if state == "deducted" then
+		return 1
+	elseif state then
+		return 5
+	end
+end
+
 -- 重复购买
 local current_buy = tonumber(redis.call('hget', KEYS[2], ARGV[2])) or 0
 local want_buy = tonumber(ARGV[1])
-local limit = tonumber(ARGV[3])  -- 每人限购ARGV[3]件
+local limit = tonumber(redis.call("GET", KEYS[5]) or ARGV[3])  -- 每人限购件数
 
 if current_buy + want_buy > limit then
 	return 3
@@ -53,32 +78,101 @@ end
 
 local stock = tonumber(redis.call("GET", KEYS[1]))
 
--- 库存不足
-if stock < want_buy then
+-- 库存不足；有人在候补时，回流的库存优先留给候补用户
+if stock < want_buy or redis.call("LLEN", KEYS[4]) > 0 then
 	return 2
 end
 
+-- 分波放量：尚未放出的库存不可售
+local locked = tonumber(redis.call("GET", KEYS[7])) or 0
+if stock - locked < want_buy then
+	return 4
+end
+
 -- 扣减库存
-redis.call("decrby", KEYS[1], want_buy)
+local after = redis.call("decrby", KEYS[1], want_buy)
 redis.call("hincrby", KEYS[2], ARGV[2], want_buy) --记录用户购买行为
+if after <= 0 then
+	redis.call("set", KEYS[6], 1) --打上售罄标记，上游可据此快速失败
+end
+if ARGV[5] ~= "" then
+	redis.call("set", KEYS[8], "deducted", "EX", ARGV[7])
+end
+
+-- 同一脚本内追加流水，保证库存变更与流水原子一致
+redis.call("xadd", KEYS[3], "*",
+	"product_id", ARGV[4], "user_id", ARGV[2], "order_id", ARGV[5],
+	"delta", -want_buy, "user_delta", want_buy, "stock_after", after, "reason", ARGV[6])
 return 1
 `
 
+// 回滚 Lua 脚本：归还库存与用户已购数量并追加流水
+// KEYS[1]: 库存 Key  KEYS[2]: 库存流水 Stream  KEYS[3]: 售罄标记 Key  KEYS[4]: 订单扣减状态 Key
+// KEYS[5]: 用户购买记录 Hash
+// ARGV[1]: 归还数量  ARGV[2]: 商品ID  ARGV[3]: 用户ID  ARGV[4]: 订单号  ARGV[5]: 变更原因
+// ARGV[6]: 订单状态保留秒数
+const ROLLBACK_LUA_SCRIPT = `
+-- 带订单号的回滚只对已扣减的订单生效一次，重复回滚或从未扣减都不会多还库存
+if ARGV[4] ~= "" then
+	if redis.call("GET", KEYS[4]) ~= "deducted" then
+		return -1
+	end
+	redis.call("SET", KEYS[4], "rolledback", "EX", ARGV[6])
+end
+
+local after = redis.call("incrby", KEYS[1], ARGV[1])
+if after > 0 then
+	redis.call("del", KEYS[3])
+end
+
+-- 订单没有成交，用户的限购名额一并退回
+local user_delta = 0
+if ARGV[3] ~= "0" then
+	local bought = tonumber(redis.call("hget", KEYS[5], ARGV[3])) or 0
+	user_delta = -math.min(bought, tonumber(ARGV[1]))
+	if bought + user_delta <= 0 then
+		redis.call("hdel", KEYS[5], ARGV[3])
+	else
+		redis.call("hincrby", KEYS[5], ARGV[3], user_delta)
+	end
+end
+
+redis.call("xadd", KEYS[2], "*",
+	"product_id", ARGV[2], "user_id", ARGV[3], "order_id", ARGV[4],
+	"delta", ARGV[1], "user_delta", user_delta, "stock_after", after, "reason", ARGV[5])
+return after
+`
+
 // 升级 DeductStock 接口，区分库存为零与商品不存在两种情况
 func (s *server) DeductStock(ctx context.Context, req *pb.DeductStockRequest) (*pb.DeductStockResponse, error) {
 	fmt.Printf("[Trace]扣减库存：用户%d, 商品%d, 数量%d\n", req.UserId, req.ProductId, req.Count)
 	// 拼接 Key: product:stock:1
 	stockKey := "product:stock:" + strconv.FormatInt(req.ProductId, 10)
 	userSetKey := "product:users:" + strconv.FormatInt(req.ProductId, 10) //新增用户购买集合Key
+	limitKey := "product:limit:" + strconv.FormatInt(req.ProductId, 10)
+	soldOutKey := "product:soldout:" + strconv.FormatInt(req.ProductId, 10)
+	lockedKey := "product:locked:" + strconv.FormatInt(req.ProductId, 10)
+	orderKey := ledger.OrderStateKeyPrefix + req.OrderId
+
+	PurchaseLimit := purchaseLimit() // 限购数据在配置文件中设置，未设置默认每人限购1件；活动限购在预热时写入 Redis
+	waitlistKey, _ := waitlistKeys(req.ProductId)
 
-	PurchaseLimit := config.Conf.Seckill.PurchaseLimit // 限购数据在配置文件中设置
+	// 抽签发售的商品只能由开奖流程扣减
+	if config.GetActivity(req.ProductId).IsRaffle() && req.Reason != ledger.ReasonRaffle {
+		return &pb.DeductStockResponse{
+			Success: false,
+			Message: "该商品为抽签发售，请先登记抽签",
+		}, nil
+	}
 
-	if PurchaseLimit <= 0 {
-		PurchaseLimit = 1 // 预防限购未设置，默认每人限购1件
+	reason := req.Reason
+	if reason == "" {
+		reason = ledger.ReasonDeduct
 	}
 
 	// 执行 Lua 脚本
-	val, err := rdb.Eval(ctx, LUA_SCRIPT, []string{stockKey, userSetKey}, req.Count, req.UserId, PurchaseLimit).Int()
+	val, err := rdb.Eval(ctx, LUA_SCRIPT, []string{stockKey, userSetKey, ledger.StreamKey, waitlistKey, limitKey, soldOutKey, lockedKey, orderKey},
+		req.Count, req.UserId, PurchaseLimit, req.ProductId, req.OrderId, reason, int(ledger.OrderStateTTL.Seconds())).Int()
 
 	if err != nil {
 		log.Printf("❌ Redis执行异常: %v", err)
@@ -95,19 +189,35 @@ func (s *server) DeductStock(ctx context.Context, req *pb.DeductStockRequest) (*
 		}, nil
 	case 2: // 库存不足
 		log.Printf("拒绝扣减：商品 %d 库存不足", req.ProductId)
+		msg := "库存不足"
+		if activity := config.GetActivity(req.ProductId); activity != nil && activity.Waitlist {
+			msg = "库存不足，可加入候补队列"
+		}
 		return &pb.DeductStockResponse{
 			Success: false,
-			Message: "库存不足",
+			Message: msg,
 		}, nil
 	case 1: // 成功
 		fmt.Printf("扣减成功：用户%d买到了商品 %d \n", req.UserId, req.ProductId)
 		return &pb.DeductStockResponse{Success: true, Message: "扣减成功"}, nil
 	case 3: // 重复购买
-		log.Printf("超过限购：用户 %d 试图购买商品 %d 一共%d件，限购%d 件", req.UserId, req.ProductId, req.Count, PurchaseLimit)
+		log.Printf("超过限购：用户 %d 试图购买商品 %d 一共%d件", req.UserId, req.ProductId, req.Count)
 		return &pb.DeductStockResponse{
 			Success: false,
 			Message: "每人限购一件，您已购买过该商品，不能重复购买",
 		}, nil
+	case 4: // 本波库存已售完
+		log.Printf("拒绝扣减：商品 %d 本波放量已售完", req.ProductId)
+		return &pb.DeductStockResponse{
+			Success: false,
+			Message: "本轮库存已抢完，请等待下一波放量",
+		}, nil
+	case 5: // 订单已回滚
+		log.Printf("拒绝扣减：订单 %s 已回滚", req.OrderId)
+		return &pb.DeductStockResponse{
+			Success: false,
+			Message: "订单已取消",
+		}, nil
 	default:
 		return &pb.DeductStockResponse{Success: false, Message: "未知错误"}, nil
 	}
@@ -115,18 +225,33 @@ func (s *server) DeductStock(ctx context.Context, req *pb.DeductStockRequest) (*
 
 // 实现 RollbackStock 接口
 func (s *server) RollbackStock(ctx context.Context, req *pb.DeductStockRequest) (*pb.DeductStockResponse, error) {
-	fmt.Printf("[Rollback]收到回滚请求：商品%d, 数量%d\n", req.ProductId, req.Count)
+	fmt.Printf("[Rollback]收到回滚请求：商品%d, 数量%d, 订单%s\n", req.ProductId, req.Count, req.OrderId)
 
 	key := "product:stock:" + strconv.FormatInt(req.ProductId, 10)
+	soldOutKey := "product:soldout:" + strconv.FormatInt(req.ProductId, 10)
+	userSetKey := "product:users:" + strconv.FormatInt(req.ProductId, 10)
+
+	reason := req.Reason
+	if reason == "" {
+		reason = ledger.ReasonRollback
+	}
 
-	//使用Redis的INCRBY原子操作回滚库存
-	err := rdb.IncrBy(ctx, key, int64(req.Count)).Err()
+	//使用Lua脚本原子回滚库存并记录流水
+	val, err := rdb.Eval(ctx, ROLLBACK_LUA_SCRIPT, []string{key, ledger.StreamKey, soldOutKey, ledger.OrderStateKeyPrefix + req.OrderId, userSetKey},
+		req.Count, req.ProductId, req.UserId, req.OrderId, reason, int(ledger.OrderStateTTL.Seconds())).Int()
 	if err != nil {
 		fmt.Printf("X! 回滚失败，CRITICAL ERROR：%v\n", err)
 		return &pb.DeductStockResponse{Success: false, Message: "回滚失败: " + err.Error()}, nil
 	}
+	if val < 0 {
+		fmt.Printf("订单%s未扣减或已回滚，无需回滚\n", req.OrderId)
+		return &pb.DeductStockResponse{Success: true, Message: "无需回滚"}, nil
+	}
+
+	fmt.Printf("回滚成功，库存与用户限购已恢复\n")
 
-	fmt.Printf("回滚成功，库存已恢复\n")
+	// 回流的库存优先分配给候补用户
+	allocateWaitlist(ctx, req.ProductId)
 	return &pb.DeductStockResponse{Success: true, Message: "回滚成功"}, nil
 }
 
@@ -154,6 +279,9 @@ func (s *server) GetProduct(ctx context.Context, req *pb.ProductRequest) (*pb.Pr
 
 	var product Product
 	if err := db.First(&product, req.ProductId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, status.Errorf(codes.NotFound, "商品 %d 不存在", req.ProductId)
+		}
 		return nil, err
 	}
 	return &pb.ProductResponse{
@@ -183,6 +311,11 @@ func preheatStock() {
 	db.Find(&products) // 查出所有商品
 
 	for _, p := range products {
+		// 配置了活动时间的商品由活动调度器按时预热
+		if a := config.GetActivity(p.ID); a != nil && a.StartTime != "" {
+			continue
+		}
+
 		key := "product:stock:" + strconv.FormatInt(p.ID, 10)
 
 		// SetNX: 如果 Key 不存在才设置 (防止重启服务覆盖了已经扣减的库存)
@@ -196,7 +329,8 @@ func preheatStock() {
 	}
 }
 
-func RegisterEtcd(port string) {
+// RegisterEtcd 注册服务并保持租约，返回注销函数
+func RegisterEtcd(port string) func() {
 	etcdAddr := config.Conf.Etcd.Addr
 	myAddr := "127.0.0.1:" + port
 
@@ -212,6 +346,16 @@ func RegisterEtcd(port string) {
 		}
 	}()
 	fmt.Printf("✅ 服务已注册到 Etcd: %s\n", myAddr)
+
+	// 关闭时先注销并撤销租约，网关立即摘除本实例，不必等租约过期
+	return func() {
+		ctx, cancel := graceful.Context()
+		defer cancel()
+		em.DeleteEndpoint(ctx, SERVICE_NAME+"/"+myAddr)
+		cli.Revoke(ctx, lease.ID)
+		cli.Close()
+		fmt.Println("已从 Etcd 注销")
+	}
 }
 
 func initDB() {
@@ -228,6 +372,7 @@ func main() {
 	shutdown := tracer.InitTracer("product-service", "localhost:4318")
 	defer shutdown(context.Background())
 	config.InitConfig("product")
+	config.InitActivities()
 	//获取端口
 	port := viper.GetString("server.product_port")
 	if port == "" {
@@ -237,13 +382,24 @@ func main() {
 	initDB()
 	initRedis()    // 1. 连 Redis
 	preheatStock() // 2. 预热库存
-	RegisterEtcd(port)
 
-	//新端口暴露 Prometheus
-	go func() {
-		//拼接冒号":9091"
-		metricsAddr := fmt.Sprintf(":%s", config.Conf.Server.MetricsPort)
+	// 后台任务，关闭时通知退出并等待当前批次/任务完成
+	stop := make(chan struct{})
+	var workers sync.WaitGroup
+	for _, run := range []func(<-chan struct{}){startLedgerDrainer, runActivityScheduler} {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(stop)
+		}()
+	}
+	deregister := RegisterEtcd(port)
 
+	//新端口暴露 Prometheus，拼接冒号":9091"
+	//Addr 在启动协程前设置，避免与关闭时的 Shutdown 并发读写
+	metricsAddr := fmt.Sprintf(":%s", config.Conf.Server.MetricsPort)
+	metricsServer := &http.Server{Addr: metricsAddr}
+	go func() {
 		//===新增开发环境重置接口===
 		if config.Conf.Server.Mode == "debug" {
 			fmt.Println("警告：当前为开发环境，启用重置接口 /dev/reset")
@@ -265,6 +421,13 @@ func main() {
 				}
 				fmt.Println("MySQL 订单表已清空")
 
+				// Redis 已清空，流水也要一起清掉，否则重建时会重复叠加
+				if err := db.Exec("TRUNCATE TABLE `inventory_ledger`").Error; err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					w.Write([]byte("MySQL 库存流水表重置失败: " + err.Error()))
+					return
+				}
+
 				preheatStock()
 
 				w.Write([]byte("环境已重置，Redis已清空并重新预热库存"))
@@ -272,7 +435,7 @@ func main() {
 		}
 		http.Handle("/metrics", promhttp.Handler())
 		fmt.Println("商品监控服务已启动：" + metricsAddr)
-		http.ListenAndServe(metricsAddr, nil)
+		metricsServer.ListenAndServe()
 	}()
 
 	grpcAddr := fmt.Sprintf(":%s", config.Conf.Server.Port)
@@ -294,7 +457,23 @@ func main() {
 
 	fmt.Println("=== 商品微服务 (Redis版) 已启动 ===")
 
-	if err := s.Serve(lis); err != nil {
-		log.Fatalf("服务启动失败：%v", err)
-	}
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Fatalf("服务启动失败：%v", err)
+		}
+	}()
+
+	// 优雅关闭：先从 Etcd 注销，再等进行中的请求处理完，
+	// 然后停止后台任务(流水落库、活动调度)并等待当前批次写完，最后刷新链路追踪(defer)
+	graceful.WaitSignal()
+	deregister()
+	graceful.StopGRPC(s)
+
+	close(stop)
+	graceful.Wait(&workers, "后台任务")
+
+	ctx, cancel := graceful.Context()
+	defer cancel()
+	metricsServer.Shutdown(ctx)
+	fmt.Println("商品服务已关闭")
 }
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"seckill-mall/common/config"
+	"seckill-mall/common/ledger"
+)
+
+const (
+	schedulerInterval = 10 * time.Second
+	// 任务标记保留时间，足够覆盖活动周期，过期后 Redis 自动清理
+	jobMarkerTTL = 7 * 24 * time.Hour
+)
+
+// 活动预热 Lua 脚本：重置库存、限购、售罄标记、候补队列与分波放量状态，并记录一条预热流水
+// KEYS[1]: 库存 Key  KEYS[2]: 用户购买记录 Hash  KEYS[3]: 活动限购 Key  KEYS[4]: 售罄标记 Key
+// KEYS[5]: 库存流水 Stream  KEYS[6]: 候补队列 List  KEYS[7]: 候补用户 Set
+// KEYS[8]: 未放出库存 Key  KEYS[9]: 已放量波次 Hash
+// ARGV[1]: 库存  ARGV[2]: 限购(0 表示使用全局配置)  ARGV[3]: 商品ID  ARGV[4]: 暂不放出的库存
+const PREHEAT_LUA = `
+redis.call("SET", KEYS[1], ARGV[1])
+redis.call("DEL", KEYS[2], KEYS[6], KEYS[7], KEYS[9])
+
+if tonumber(ARGV[4]) > 0 then
+	redis.call("SET", KEYS[8], ARGV[4])
+else
+	redis.call("DEL", KEYS[8])
+end
+
+if tonumber(ARGV[2]) > 0 then
+	redis.call("SET", KEYS[3], ARGV[2])
+else
+	redis.call("DEL", KEYS[3])
+end
+
+if tonumber(ARGV[1]) <= 0 then
+	redis.call("SET", KEYS[4], 1)
+else
+	redis.call("DEL", KEYS[4])
+end
+
+redis.call("XADD", KEYS[5], "*",
+	"product_id", ARGV[3], "user_id", 0, "order_id", "",
+	"delta", 0, "user_delta", 0, "stock_after", ARGV[1], "reason", "` + ledger.ReasonPreheat + `")
+return 1
+`
+
+// 活动结束清理 Lua 脚本，KEYS 与预热脚本一致
+const CLEANUP_LUA = `
+redis.call("DEL", KEYS[1], KEYS[2], KEYS[3], KEYS[4], KEYS[6], KEYS[7], KEYS[8], KEYS[9])
+redis.call("XADD", KEYS[5], "*",
+	"product_id", ARGV[1], "user_id", 0, "order_id", "",
+	"delta", 0, "user_delta", 0, "stock_after", 0, "reason", "` + ledger.ReasonCleanup + `")
+return 1
+`
+
+func activityKeys(productID int64) []string {
+	id := strconv.FormatInt(productID, 10)
+	listKey, waitUserKey := waitlistKeys(productID)
+	return []string{
+		"product:stock:" + id,
+		"product:users:" + id,
+		"product:limit:" + id,
+		"product:soldout:" + id,
+		ledger.StreamKey,
+		listKey,
+		waitUserKey,
+		"product:locked:" + id,
+		"product:waves:" + id,
+	}
+}
+
+// runActivityScheduler 按活动时间窗定时预热、分波放量与清理
+// 每个任务通过 Redis SETNX 标记只由一个实例执行一次
+func runActivityScheduler(stop <-chan struct{}) {
+	ctx := context.Background()
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	fmt.Println("⏰ 活动调度器已启动")
+	for {
+		for i := range config.Activities {
+			scheduleActivity(ctx, &config.Activities[i])
+		}
+		select {
+		case <-stop:
+			// 当前一轮任务已执行完，不会中途打断预热/放量的写入
+			fmt.Println("⏰ 活动调度器已退出")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func scheduleActivity(ctx context.Context, a *config.ActivityConfig) {
+	start, end, err := a.Window()
+	if err != nil {
+		log.Printf("活动 %d 时间配置有误: %v", a.ProductID, err)
+		return
+	}
+	if start.IsZero() {
+		return
+	}
+
+	minutes := a.PreheatMinutes
+	if minutes <= 0 {
+		minutes = config.Conf.Seckill.PreheatMinutes
+	}
+	preheatAt := start.Add(-time.Duration(minutes) * time.Minute)
+
+	now := time.Now()
+	if !now.Before(preheatAt) && (end.IsZero() || now.Before(end)) {
+		runJobOnce(ctx, "preheat", a.ProductID, start, func() error { return preheatActivity(ctx, a) })
+
+		for i := range a.Waves {
+			at, err := config.ParseTime(a.Waves[i].At)
+			if err != nil || now.Before(at) {
+				continue
+			}
+			wave := i
+			runJobOnce(ctx, fmt.Sprintf("wave%d", wave+1), a.ProductID, start, func() error { return releaseWave(ctx, a, wave) })
+		}
+		updateWaveMetrics(ctx, a)
+	}
+	if !end.IsZero() && !now.Before(end) {
+		runJobOnce(ctx, "cleanup", a.ProductID, start, func() error { return cleanupActivity(ctx, a) })
+	}
+}
+
+// runJobOnce 同一场活动的同一任务只执行一次，失败时释放标记等待下次重试
+func runJobOnce(ctx context.Context, job string, productID int64, start time.Time, fn func() error) {
+	key := fmt.Sprintf("seckill:job:%s:%d:%d", job, productID, start.Unix())
+	ok, err := rdb.SetNX(ctx, key, instanceName(), jobMarkerTTL).Result()
+	if err != nil || !ok {
+		return
+	}
+
+	if err := fn(); err != nil {
+		log.Printf("X! 活动任务 %s 执行失败(商品 %d)，稍后重试: %v", job, productID, err)
+		rdb.Del(ctx, key)
+	}
+}
+
+func preheatActivity(ctx context.Context, a *config.ActivityConfig) error {
+	var p Product
+	if err := db.First(&p, a.ProductID).Error; err != nil {
+		return err
+	}
+
+	// 配置了分波放量时，预热后全部库存先锁住，到点逐波放出
+	var locked int32
+	if len(a.Waves) > 0 {
+		locked = p.Stock
+	}
+
+	err := rdb.Eval(ctx, PREHEAT_LUA, activityKeys(a.ProductID), p.Stock, a.PurchaseLimit, a.ProductID, locked).Err()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("🔥 活动已预热: 商品%d 库存 %d 限购 %d 待放量 %d\n", a.ProductID, p.Stock, a.PurchaseLimit, locked)
+	return nil
+}
+
+func cleanupActivity(ctx context.Context, a *config.ActivityConfig) error {
+	if err := rdb.Eval(ctx, CLEANUP_LUA, activityKeys(a.ProductID), a.ProductID).Err(); err != nil {
+		return err
+	}
+	fmt.Printf("🧹 活动已结束，已清理商品%d的 Redis Key\n", a.ProductID)
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"seckill-mall/common/config"
+	"seckill-mall/common/ledger"
+	"seckill-mall/common/pb"
+	"seckill-mall/common/utils"
+	"seckill-mall/common/waitlist"
+)
+
+// 加入候补 Lua 脚本
+// KEYS[1]: 库存 Key  KEYS[2]: 用户购买记录 Hash  KEYS[3]: 候补队列 List  KEYS[4]: 候补用户 Set
+// KEYS[5]: 活动限购 Key
+// ARGV[1]: 用户ID  ARGV[2]: 数量  ARGV[3]: 默认限购数量  ARGV[4]: 队列上限(0不限)
+const JOIN_WAITLIST_LUA = `
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+
+-- 还有库存，直接下单即可
+if tonumber(redis.call("GET", KEYS[1])) > 0 then
+	return -2
+end
+
+local bought = tonumber(redis.call("HGET", KEYS[2], ARGV[1])) or 0
+if bought + tonumber(ARGV[2]) > tonumber(redis.call("GET", KEYS[5]) or ARGV[3]) then
+	return -3
+end
+
+if redis.call("SISMEMBER", KEYS[4], ARGV[1]) == 1 then
+	return -4
+end
+
+local max = tonumber(ARGV[4])
+if max > 0 and redis.call("LLEN", KEYS[3]) >= max then
+	return -5
+end
+
+redis.call("SADD", KEYS[4], ARGV[1])
+return redis.call("RPUSH", KEYS[3], ARGV[1] .. ":" .. ARGV[2])
+`
+
+// 候补分配 Lua 脚本：按先来后到把回流库存分给队首用户，一次只分配一单
+// KEYS[1]: 库存 Key  KEYS[2]: 用户购买记录 Hash  KEYS[3]: 库存流水 Stream
+// KEYS[4]: 候补队列 List  KEYS[5]: 候补用户 Set  KEYS[6]: 分配结果队列
+// KEYS[7]: 活动限购 Key  KEYS[8]: 售罄标记 Key  KEYS[9]: 订单扣减状态 Key
+// ARGV[1]: 商品ID  ARGV[2]: 订单号  ARGV[3]: 默认限购数量  ARGV[4]: 订单状态保留秒数
+const ALLOCATE_WAITLIST_LUA = `
+local stock = tonumber(redis.call("GET", KEYS[1]) or "0")
+local limit = tonumber(redis.call("GET", KEYS[7]) or ARGV[3])
+while true do
+	local head = redis.call("LINDEX", KEYS[4], 0)
+	if not head then
+		return 0
+	end
+
+	local sep = string.find(head, ":")
+	local uid = string.sub(head, 1, sep - 1)
+	local want = tonumber(string.sub(head, sep + 1))
+
+	-- 严格按顺序分配：队首不够分就等下一次回流
+	if stock < want then
+		return 0
+	end
+
+	redis.call("LPOP", KEYS[4])
+	redis.call("SREM", KEYS[5], uid)
+
+	-- 排队期间用户可能已经通过其他途径买到，超出限购的直接跳过
+	local bought = tonumber(redis.call("HGET", KEYS[2], uid)) or 0
+	if bought + want <= limit then
+		local after = redis.call("DECRBY", KEYS[1], want)
+		if after <= 0 then
+			redis.call("SET", KEYS[8], 1)
+		end
+		redis.call("HINCRBY", KEYS[2], uid, want)
+		redis.call("SET", KEYS[9], "deducted", "EX", ARGV[4])
+		redis.call("XADD", KEYS[3], "*",
+			"product_id", ARGV[1], "user_id", uid, "order_id", ARGV[2],
+			"delta", -want, "user_delta", want, "stock_after", after, "reason", "` + ledger.ReasonWaitlist + `")
+		redis.call("RPUSH", KEYS[6], '{"order_id":"' .. ARGV[2] .. '","user_id":' .. uid ..
+			',"product_id":' .. ARGV[1] .. ',"count":' .. want .. '}')
+		return 1
+	end
+end
+`
+
+func waitlistKeys(productID int64) (listKey, userSetKey string) {
+	id := strconv.FormatInt(productID, 10)
+	return "product:waitlist:" + id, "product:waitlist:users:" + id
+}
+
+func purchaseLimit() int64 {
+	if config.Conf.Seckill.PurchaseLimit <= 0 {
+		return 1
+	}
+	return config.Conf.Seckill.PurchaseLimit
+}
+
+// JoinWaitlist 售罄后加入候补队列
+func (s *server) JoinWaitlist(ctx context.Context, req *pb.WaitlistRequest) (*pb.WaitlistResponse, error) {
+	activity := config.GetActivity(req.ProductId)
+	if activity == nil || !activity.Waitlist {
+		return &pb.WaitlistResponse{Success: false, Message: "该商品未开放候补"}, nil
+	}
+	if req.Count <= 0 {
+		req.Count = 1
+	}
+
+	id := strconv.FormatInt(req.ProductId, 10)
+	listKey, waitUserKey := waitlistKeys(req.ProductId)
+	val, err := rdb.Eval(ctx, JOIN_WAITLIST_LUA,
+		[]string{"product:stock:" + id, "product:users:" + id, listKey, waitUserKey, "product:limit:" + id},
+		req.UserId, req.Count, purchaseLimit(), activity.WaitlistSize).Int64()
+	if err != nil {
+		log.Printf("❌ Redis执行异常: %v", err)
+		return nil, err
+	}
+
+	switch val {
+	case -1:
+		return &pb.WaitlistResponse{Success: false, Message: "商品不存在或未上架"}, nil
+	case -2:
+		return &pb.WaitlistResponse{Success: false, Message: "商品尚有库存，请直接下单"}, nil
+	case -3:
+		return &pb.WaitlistResponse{Success: false, Message: "超过限购数量，不能加入候补"}, nil
+	case -4:
+		return &pb.WaitlistResponse{Success: false, Message: "您已在候补队列中"}, nil
+	case -5:
+		return &pb.WaitlistResponse{Success: false, Message: "候补人数已满"}, nil
+	}
+
+	fmt.Printf("[Waitlist]用户%d加入商品%d候补，排第%d位\n", req.UserId, req.ProductId, val)
+	return &pb.WaitlistResponse{Success: true, Message: "已加入候补队列", Position: val}, nil
+}
+
+// allocateWaitlist 库存回流后，依次分配给候补用户，直到库存或队列耗尽
+// 只由 RollbackStock 调用：订单的各种取消路径都经由按订单号回滚归还库存，新增的取消入口也需走回滚
+func allocateWaitlist(ctx context.Context, productID int64) {
+	activity := config.GetActivity(productID)
+	if activity == nil || !activity.Waitlist {
+		return
+	}
+
+	id := strconv.FormatInt(productID, 10)
+	listKey, waitUserKey := waitlistKeys(productID)
+	for {
+		orderID := utils.GenerateOrderID()
+		keys := []string{"product:stock:" + id, "product:users:" + id, ledger.StreamKey, listKey, waitUserKey, waitlist.AllocationKey,
+			"product:limit:" + id, "product:soldout:" + id, ledger.OrderStateKeyPrefix + orderID}
+		val, err := rdb.Eval(ctx, ALLOCATE_WAITLIST_LUA, keys, productID, orderID, purchaseLimit(), int(ledger.OrderStateTTL.Seconds())).Int()
+		if err != nil {
+			log.Printf("候补分配失败，商品 %d: %v", productID, err)
+			return
+		}
+		if val == 0 {
+			return
+		}
+		fmt.Printf("[Waitlist]商品%d回流库存已分配给候补用户，订单%s\n", productID, orderID)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+
+	"seckill-mall/common/config"
+	"seckill-mall/common/ledger"
+)
+
+// 分波放量 Lua 脚本：从未放出的库存中放出一波，同一波次只放一次
+// KEYS[1]: 未放出库存 Key  KEYS[2]: 已放量波次 Hash  KEYS[3]: 库存 Key  KEYS[4]: 库存流水 Stream
+// ARGV[1]: 波次  ARGV[2]: 本波放量  ARGV[3]: 是否最后一波(1 放出剩余全部)  ARGV[4]: 商品ID
+const RELEASE_WAVE_LUA = `
+if redis.call("EXISTS", KEYS[3]) == 0 then
+	return -1
+end
+if redis.call("HEXISTS", KEYS[2], ARGV[1]) == 1 then
+	return tonumber(redis.call("HGET", KEYS[2], ARGV[1]))
+end
+
+local locked = tonumber(redis.call("GET", KEYS[1])) or 0
+local amount = tonumber(ARGV[2])
+if ARGV[3] == "1" or amount > locked then
+	amount = locked
+end
+
+local left = redis.call("DECRBY", KEYS[1], amount)
+if left <= 0 then
+	redis.call("DEL", KEYS[1])
+end
+redis.call("HSET", KEYS[2], ARGV[1], amount)
+
+-- 放量不改变库存总量，delta 为 0，仅留痕
+redis.call("XADD", KEYS[4], "*",
+	"product_id", ARGV[4], "user_id", 0, "order_id", "wave-" .. ARGV[1],
+	"delta", 0, "user_delta", 0, "stock_after", redis.call("GET", KEYS[3]), "reason", "` + ledger.ReasonWave + `")
+return amount
+`
+
+var (
+	waveReleased = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "seckill_wave_released_units",
+		Help: "每一波放出的库存数量",
+	}, []string{"product_id", "wave"})
+
+	waveProgress = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "seckill_wave_progress_ratio",
+		Help: "每一波放出库存的售出比例 (0~1)",
+	}, []string{"product_id", "wave"})
+
+	waveSellable = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "seckill_wave_sellable_units",
+		Help: "当前可售(已放出未售出)的库存",
+	}, []string{"product_id"})
+
+	waveLocked = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "seckill_wave_locked_units",
+		Help: "尚未放出的库存",
+	}, []string{"product_id"})
+)
+
+// releaseWave 放出第 wave 波(从 0 开始)库存，放量按商品总库存的百分比计算
+func releaseWave(ctx context.Context, a *config.ActivityConfig, wave int) error {
+	var p Product
+	if err := db.First(&p, a.ProductID).Error; err != nil {
+		return err
+	}
+
+	id := strconv.FormatInt(a.ProductID, 10)
+	amount := int64(p.Stock) * a.Waves[wave].Percent / 100
+	last := "0"
+	if wave == len(a.Waves)-1 {
+		last = "1"
+	}
+
+	released, err := rdb.Eval(ctx, RELEASE_WAVE_LUA,
+		[]string{"product:locked:" + id, "product:waves:" + id, "product:stock:" + id, ledger.StreamKey},
+		wave+1, amount, last, a.ProductID).Int64()
+	if err != nil {
+		return err
+	}
+	if released < 0 {
+		return fmt.Errorf("商品 %d 尚未预热", a.ProductID)
+	}
+
+	waveReleased.WithLabelValues(id, strconv.Itoa(wave+1)).Set(float64(released))
+	fmt.Printf("🌊 商品%d 第%d波放量 %d 件\n", a.ProductID, wave+1, released)
+	return nil
+}
+
+// updateWaveMetrics 根据当前库存推算各波次的售出进度：先放出的波次先卖完
+func updateWaveMetrics(ctx context.Context, a *config.ActivityConfig) {
+	if len(a.Waves) == 0 {
+		return
+	}
+
+	id := strconv.FormatInt(a.ProductID, 10)
+	stock, err := rdb.Get(ctx, "product:stock:"+id).Int64()
+	if err != nil {
+		return
+	}
+	locked, err := rdb.Get(ctx, "product:locked:"+id).Int64()
+	if err != nil && err != redis.Nil {
+		return
+	}
+	waves, err := rdb.HGetAll(ctx, "product:waves:"+id).Result()
+	if err != nil {
+		return
+	}
+
+	sellable := stock - locked
+	waveSellable.WithLabelValues(id).Set(float64(sellable))
+	waveLocked.WithLabelValues(id).Set(float64(locked))
+
+	var totalReleased int64
+	for i := range a.Waves {
+		n, _ := strconv.ParseInt(waves[strconv.Itoa(i+1)], 10, 64)
+		totalReleased += n
+	}
+
+	// 已售出 = 已放出 - 当前可售，依次记到各波次上
+	sold := totalReleased - sellable
+	for i := range a.Waves {
+		label := strconv.Itoa(i + 1)
+		n, _ := strconv.ParseInt(waves[label], 10, 64)
+		waveReleased.WithLabelValues(id, label).Set(float64(n))
+
+		ratio := 0.0
+		if n > 0 {
+			used := min(max(sold, 0), n)
+			ratio = float64(used) / float64(n)
+			sold -= used
+		}
+		waveProgress.WithLabelValues(id, label).Set(ratio)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"seckill-mall/common/raffle"
+)
+
+// 抽签复现工具：用开奖后公开的种子与参与名单重新计算中签者，供审计核对
+//
+//	go run ./raffle_verify -seed <seed> -participants users.txt -winners 100 -commitment <sha256> -digest <sha256>
+func main() {
+	seed := flag.String("seed", "", "开奖后公开的种子")
+	file := flag.String("participants", "", "参与名单文件，每行一个 UserID (或用逗号分隔)")
+	winners := flag.Int("winners", 0, "中签名额")
+	commitment := flag.String("commitment", "", "登记期间公开的种子承诺值(可选)")
+	digest := flag.String("digest", "", "开奖时公开的参与名单摘要(可选)")
+	flag.Parse()
+
+	if *seed == "" || *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	raw, err := os.ReadFile(*file)
+	if err != nil {
+		log.Fatalf("读取参与名单失败: %v", err)
+	}
+	var participants []int64
+	for _, f := range strings.FieldsFunc(string(raw), func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r' || r == ' ' || r == '\t'
+	}) {
+		uid, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			log.Fatalf("非法的 UserID %q: %v", f, err)
+		}
+		participants = append(participants, uid)
+	}
+
+	ok := true
+	if *commitment != "" {
+		got := raffle.Commitment(*seed)
+		fmt.Printf("种子承诺值: %s (%s)\n", got, verdict(got == *commitment))
+		ok = ok && got == *commitment
+	}
+	d := raffle.ParticipantsDigest(participants)
+	if *digest != "" {
+		fmt.Printf("名单摘要:   %s (%s)\n", d, verdict(d == *digest))
+		ok = ok && d == *digest
+	} else {
+		fmt.Printf("名单摘要:   %s\n", d)
+	}
+
+	picked := raffle.Draw(*seed, participants, *winners)
+	fmt.Printf("参与 %d 人，中签 %d 人：\n", len(participants), len(picked))
+	for i, uid := range picked {
+		fmt.Printf("%d\t%d\n", i+1, uid)
+	}
+
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func verdict(match bool) string {
+	if match {
+		return "一致"
+	}
+	return "不一致!"
+}
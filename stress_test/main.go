@@ -2,10 +2,13 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math/bits"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -18,6 +21,24 @@ const (
 	ProductID     = 1
 )
 
+type ChallengeResponse struct {
+	Code        int    `json:"code"`
+	Required    bool   `json:"required"`
+	ChallengeID string `json:"challenge_id"`
+	Challenge   struct {
+		Kind   string `json:"kind"`
+		Prefix string `json:"prefix"`
+		Bits   int    `json:"bits"`
+	} `json:"challenge"`
+	Msg string `json:"message"`
+}
+
+type PathResponse struct {
+	Code int    `json:"code"`
+	URL  string `json:"url"`
+	Msg  string `json:"message"`
+}
+
 type LoginResponse struct {
 	Code  int    `json:"code"`
 	Token string `json:"token"`
@@ -92,6 +113,84 @@ func login(uid int) (string, error) {
 	return res.Token, nil
 }
 
+// 获取并解答人机挑战，压测只支持工作量证明
+func solveChallenge(token string) (string, error) {
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/seckill/challenge/%d", BaseURL, ProductID), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	var res ChallengeResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return "", fmt.Errorf("解析响应失败")
+	}
+	if res.Code != 200 {
+		return "", fmt.Errorf("服务端错误: %s", string(body))
+	}
+	if !res.Required {
+		return "", nil
+	}
+	if res.Challenge.Kind != "pow" {
+		return "", fmt.Errorf("压测不支持 %s 类型的挑战，请为压测商品配置 pow 或 none", res.Challenge.Kind)
+	}
+
+	// 暴力寻找使哈希前 bits 位为 0 的答案
+	for i := 0; ; i++ {
+		answer := strconv.Itoa(i)
+		sum := sha256.Sum256([]byte(res.Challenge.Prefix + answer))
+		if leadingZeroBits(sum[:]) >= res.Challenge.Bits {
+			return "?challenge_id=" + res.ChallengeID + "&answer=" + answer, nil
+		}
+	}
+}
+
+func leadingZeroBits(sum []byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// 获取秒杀地址
+func seckillPath(token string) (string, error) {
+	query, err := solveChallenge(token)
+	if err != nil {
+		return "", err
+	}
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/seckill/path/%d%s", BaseURL, ProductID, query), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	var res PathResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return "", fmt.Errorf("解析响应失败")
+	}
+	if res.Code != 200 {
+		return "", fmt.Errorf("服务端错误: %s", string(body))
+	}
+	return res.URL, nil
+}
+
 // 下单动作
 func createOrder(uid int, token string) {
 	reqBody := map[string]interface{}{
@@ -100,7 +199,14 @@ func createOrder(uid int, token string) {
 	}
 	jsonData, _ := json.Marshal(reqBody)
 
-	req, _ := http.NewRequest("POST", BaseURL+"/order", bytes.NewBuffer(jsonData))
+	// 先获取一次性秒杀地址
+	url, err := seckillPath(token)
+	if err != nil {
+		fmt.Printf("[用户 %d] 获取秒杀地址失败: %v\n", uid, err)
+		return
+	}
+
+	req, _ := http.NewRequest("POST", BaseURL+url, bytes.NewBuffer(jsonData))
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+token)
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	otelgrpc "go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/naming/endpoints"
+
+	"seckill-mall/common/config"
+	"seckill-mall/common/graceful"
+	"seckill-mall/common/pb"
+	"seckill-mall/common/tracer"
+)
+
+const SERVICE_NAME = "seckill/user"
+
+var db *gorm.DB
+
+func initDB() {
+	var err error
+	// TranslateError 把唯一键冲突转换为 gorm.ErrDuplicatedKey，不依赖数据库报错文本
+	db, err = gorm.Open(mysql.Open(config.Conf.MySQL.DSN), &gorm.Config{TranslateError: true})
+	if err != nil {
+		log.Fatalf("连接MySQL失败: %v", err)
+	}
+	if err := db.AutoMigrate(&User{}); err != nil {
+		log.Fatalf("初始化用户表失败: %v", err)
+	}
+	fmt.Println("MySQL 连接成功！")
+}
+
+// registerEtcd 注册服务并保持租约，返回注销函数
+func registerEtcd(serviceAddr string) func() {
+	etcdAddr := config.Conf.Etcd.Addr
+
+	cli, _ := clientv3.New(clientv3.Config{Endpoints: []string{etcdAddr}})
+	em, _ := endpoints.NewManager(cli, SERVICE_NAME)
+	lease, _ := cli.Grant(context.TODO(), 10)
+
+	em.AddEndpoint(context.TODO(), SERVICE_NAME+"/"+serviceAddr, endpoints.Endpoint{Addr: serviceAddr}, clientv3.WithLease(lease.ID))
+
+	ch, _ := cli.KeepAlive(context.TODO(), lease.ID)
+	go func() {
+		for range ch {
+		}
+	}()
+	fmt.Printf("✅ 用户服务已注册到 Etcd: %s\n", serviceAddr)
+
+	return func() {
+		ctx, cancel := graceful.Context()
+		defer cancel()
+		em.DeleteEndpoint(ctx, SERVICE_NAME+"/"+serviceAddr)
+		cli.Revoke(ctx, lease.ID)
+		cli.Close()
+		fmt.Println("已从 Etcd 注销")
+	}
+}
+
+func main() {
+	//初始化链路追踪
+	shutdown := tracer.InitTracer("user-service", "localhost:4318")
+	defer shutdown(context.Background())
+
+	config.InitConfig("user")
+	port := config.Conf.Server.Port
+	if port == "" {
+		port = "50053"
+		log.Println("配置文件未指定端口，使用默认端口 50053")
+	}
+
+	initDB()
+	deregister := registerEtcd("127.0.0.1:" + port)
+
+	//启动Prometheus监控(Port:9094)
+	metricsServer := &http.Server{Addr: fmt.Sprintf(":%s", config.Conf.Server.MetricsPort)}
+	go func() {
+		http.Handle("/metrics", promhttp.Handler())
+		fmt.Printf("用户服务监控已启动 %s/metrics\n", metricsServer.Addr)
+
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fmt.Printf("启动用户服务监控失败: %v", err)
+		}
+	}()
+
+	lis, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		log.Fatalf("监听端口失败 %s: %v", port, err)
+	}
+
+	s := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.StreamInterceptor(grpc_prometheus.StreamServerInterceptor),
+		grpc.UnaryInterceptor(grpc_prometheus.UnaryServerInterceptor),
+	)
+	pb.RegisterUserServiceServer(s, &server{})
+	grpc_prometheus.Register(s)
+
+	fmt.Printf("=== 用户微服务已启动 (Port: %s) ===\n", port)
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Fatalf("服务启动失败: %v", err)
+		}
+	}()
+
+	// 优雅关闭：先从 Etcd 注销，再等进行中的请求处理完
+	graceful.WaitSignal()
+	deregister()
+	graceful.StopGRPC(s)
+
+	ctx, cancel := graceful.Context()
+	defer cancel()
+	metricsServer.Shutdown(ctx)
+	fmt.Println("用户服务已关闭")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"seckill-mall/common/pb"
+	"seckill-mall/common/utils"
+)
+
+const (
+	minPasswordLen = 8
+	maxPasswordLen = 72 // bcrypt 只使用前 72 字节，更长的密码直接拒绝，避免两个密码前缀相同即可互相登录
+	maxNicknameLen = 32
+)
+
+// 用户名只允许字母、数字、下划线
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,32}$`)
+
+// 用户名不存在时也做一次哈希比较，使响应时间与密码错误一致，避免通过耗时探测用户名
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("seckill-dummy-password"), bcrypt.DefaultCost)
+
+// User 用户表，密码只保存 bcrypt 哈希
+type User struct {
+	ID           int64     `gorm:"column:id;primaryKey;autoIncrement"`
+	Username     string    `gorm:"column:username;type:varchar(32);uniqueIndex;not null"`
+	PasswordHash string    `gorm:"column:password_hash;type:varchar(72);not null"`
+	Nickname     string    `gorm:"column:nickname;type:varchar(64)"`
+	CreatedAt    time.Time `gorm:"column:created_at"`
+	UpdatedAt    time.Time `gorm:"column:updated_at"`
+}
+
+func (User) TableName() string { return "users" }
+
+type server struct {
+	pb.UnimplementedUserServiceServer
+}
+
+// Register 注册用户
+func (s *server) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+	if !usernamePattern.MatchString(req.Username) {
+		return &pb.RegisterResponse{Success: false, Message: "用户名需为 3~32 位字母、数字或下划线"}, nil
+	}
+	if len(req.Password) < minPasswordLen || len(req.Password) > maxPasswordLen {
+		return &pb.RegisterResponse{Success: false, Message: fmt.Sprintf("密码长度需为 %d~%d 位", minPasswordLen, maxPasswordLen)}, nil
+	}
+	if utf8.RuneCountInString(req.Nickname) > maxNicknameLen {
+		return &pb.RegisterResponse{Success: false, Message: fmt.Sprintf("昵称不能超过 %d 个字符", maxNicknameLen)}, nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	nickname := req.Nickname
+	if nickname == "" {
+		nickname = req.Username
+	}
+
+	user := &User{Username: req.Username, PasswordHash: string(hash), Nickname: nickname}
+	if err := db.WithContext(ctx).Create(user).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return &pb.RegisterResponse{Success: false, Message: "用户名已被注册"}, nil
+		}
+		log.Printf("注册用户 %s 失败: %v", req.Username, err)
+		return nil, err
+	}
+
+	if user.ID >= utils.MockUserIDBase {
+		log.Printf("🚨 [ALERT] 用户ID %d 已进入模拟登录保留区间，请检查 users 表自增值", user.ID)
+	}
+
+	fmt.Printf("新用户注册: %s (ID: %d)\n", user.Username, user.ID)
+	return &pb.RegisterResponse{Success: true, Message: "注册成功", UserId: user.ID}, nil
+}
+
+// Login 校验用户名密码，通过后由网关签发 Token
+// 用户不存在与密码错误返回同样的提示
+func (s *server) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
+	var user User
+	err := db.WithContext(ctx).Where("username = ?", req.Username).Take(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	hash := []byte(user.PasswordHash)
+	if err != nil {
+		hash = dummyHash
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(req.Password)) != nil || user.ID == 0 {
+		return &pb.LoginResponse{Success: false, Message: "用户名或密码错误"}, nil
+	}
+	return &pb.LoginResponse{Success: true, Message: "登录成功", UserId: user.ID}, nil
+}
+
+// GetProfile 查询用户资料
+func (s *server) GetProfile(ctx context.Context, req *pb.ProfileRequest) (*pb.ProfileResponse, error) {
+	var user User
+	err := db.WithContext(ctx).Take(&user, req.UserId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &pb.ProfileResponse{Success: false, Message: "用户不存在"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ProfileResponse{
+		Success:   true,
+		UserId:    user.ID,
+		Username:  user.Username,
+		Nickname:  user.Nickname,
+		CreatedAt: user.CreatedAt.Unix(),
+	}, nil
+}